@@ -0,0 +1,119 @@
+package ios
+
+import (
+	"sort"
+	"time"
+)
+
+// accountOverlapToleranceMS is the overlap of billing periods of different lineages in milliseconds,
+// which HasMultipleAccounts tolerates, because Apple doesn't always cut the period at the exact moment.
+const accountOverlapToleranceMS = int64(24 * time.Hour / time.Millisecond)
+
+// HasMultipleAccounts return true if transactions look like they were made by more than one Apple ID,
+// which happens when purchases are restored on a device after switching the Apple ID.
+//
+// This is a best-effort heuristic and should not be treated as a proof. Subscription transactions are
+// grouped into lineages by original transaction id and each billing period is identified by its
+// web order line item id, so copies of the same period restored several times are counted once.
+// Billing periods of a product made by one Apple ID follow each other continuously, so a period, which starts
+// more than a day before the period of another lineage ends, is reported as multiple accounts.
+// A period, which was upgraded or refunded, ends at its cancellation date, so the upgrade to another
+// lineage doesn't look like an overlap. Transactions without expiration date are ignored,
+// because consumables are legitimately purchased many times by the same account.
+func (i InApps) HasMultipleAccounts() bool {
+	type period struct {
+		lineage    string
+		start, end int64
+	}
+
+	products := make(map[string][]period)
+	seen := make(map[string]bool)
+	for _, inapp := range i {
+		if inapp.ExpiresDateMS <= 0 {
+			continue
+		}
+		lineItem := inapp.WebOrderLineItemID
+		if lineItem == "" {
+			lineItem = inapp.TransactionID
+		}
+		if key := inapp.OriginalTransactionID + "/" + lineItem; lineItem != "" {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+
+		end := inapp.ExpiresDateMS
+		if canceled := inapp.CancellationDateMS; canceled > 0 && canceled < end {
+			end = canceled
+		}
+		products[inapp.ProductID] = append(products[inapp.ProductID], period{
+			lineage: inapp.OriginalTransactionID,
+			start:   inapp.PurchaseDateMS,
+			end:     end,
+		})
+	}
+
+	for _, periods := range products {
+		sort.SliceStable(periods, func(a, b int) bool {
+			return periods[a].start < periods[b].start
+		})
+		// The latest ending period so far, which the next one must continue.
+		var last period
+		for n, p := range periods {
+			if n > 0 && p.lineage != last.lineage && p.start+accountOverlapToleranceMS < last.end {
+				return true
+			}
+			if n == 0 || p.end > last.end {
+				last = p
+			}
+		}
+	}
+	return false
+}
+
+// SharedUse type represents the subscription lineage, which was submitted by several users.
+type SharedUse struct {
+	OriginalTransactionID string
+	UserIDs               []string
+}
+
+// DetectSharedOriginalTransaction return the subscription lineages, which are present in the responses
+// of more than one user. The responses are keyed by user id. The same original transaction id
+// under different users means the receipt was shared between accounts of your service,
+// which is a common piracy pattern, although family sharing could produce it legitimately.
+// Lineages are sorted by original transaction id and users are sorted by id.
+func DetectSharedOriginalTransaction(responses map[string]*ValidationResponse) []SharedUse {
+	users := make(map[string]map[string]bool)
+	for userID, resp := range responses {
+		if resp == nil {
+			continue
+		}
+		for _, inapp := range resp.AllTransactions() {
+			if inapp.OriginalTransactionID == "" {
+				continue
+			}
+			if users[inapp.OriginalTransactionID] == nil {
+				users[inapp.OriginalTransactionID] = make(map[string]bool)
+			}
+			users[inapp.OriginalTransactionID][userID] = true
+		}
+	}
+
+	var shared []SharedUse
+	for originalTransactionID, ids := range users {
+		if len(ids) < 2 {
+			continue
+		}
+		use := SharedUse{OriginalTransactionID: originalTransactionID}
+		for id := range ids {
+			use.UserIDs = append(use.UserIDs, id)
+		}
+		sort.Strings(use.UserIDs)
+		shared = append(shared, use)
+	}
+	sort.Slice(shared, func(a, b int) bool {
+		return shared[a].OriginalTransactionID < shared[b].OriginalTransactionID
+	})
+	return shared
+}
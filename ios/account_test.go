@@ -0,0 +1,85 @@
+package ios
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInApps_HasMultipleAccounts(t *testing.T) {
+	type test struct {
+		inapps InApps
+		want   bool
+	}
+
+	tests := map[string]test{
+		"SingleAccount": {
+			InApps{
+				{ProductID: "monthly", OriginalTransactionID: "1", WebOrderLineItemID: "10", PurchaseDateMS: 1527811200000, ExpiresDateMS: 1530403200000},
+				{ProductID: "monthly", OriginalTransactionID: "1", WebOrderLineItemID: "11", PurchaseDateMS: 1530403200000, ExpiresDateMS: 1532995200000},
+				{ProductID: "coins", OriginalTransactionID: "2"},
+				{ProductID: "coins", OriginalTransactionID: "3"},
+			},
+			false,
+		},
+		"ResubscribedAfterLapse": {
+			InApps{
+				{ProductID: "monthly", OriginalTransactionID: "1", PurchaseDateMS: 1527811200000, ExpiresDateMS: 1530403200000},
+				{ProductID: "monthly", OriginalTransactionID: "2", PurchaseDateMS: 1535587200000, ExpiresDateMS: 1538179200000},
+			},
+			false,
+		},
+		"UpgradeOverlap": {
+			InApps{
+				{ProductID: "basic", OriginalTransactionID: "1", WebOrderLineItemID: "10", PurchaseDateMS: 1527811200000, ExpiresDateMS: 1530403200000},
+				// Upgraded to another lineage in the middle of the period, which is cut at the cancellation date.
+				{ProductID: "basic", OriginalTransactionID: "1", WebOrderLineItemID: "11", PurchaseDateMS: 1530403200000, ExpiresDateMS: 1532995200000, CancellationDateMS: 1531267200000},
+				{ProductID: "premium", OriginalTransactionID: "2", WebOrderLineItemID: "20", PurchaseDateMS: 1531267200000, ExpiresDateMS: 1532131200000},
+				{ProductID: "basic", OriginalTransactionID: "2", WebOrderLineItemID: "21", PurchaseDateMS: 1532131200000, ExpiresDateMS: 1534809600000},
+			},
+			false,
+		},
+		"RestoredCopies": {
+			InApps{
+				{ProductID: "monthly", OriginalTransactionID: "1", TransactionID: "100", WebOrderLineItemID: "10", PurchaseDateMS: 1527811200000, ExpiresDateMS: 1530403200000},
+				{ProductID: "monthly", OriginalTransactionID: "1", TransactionID: "101", WebOrderLineItemID: "10", PurchaseDateMS: 1527811200000, ExpiresDateMS: 1530403200000},
+				{ProductID: "monthly", OriginalTransactionID: "1", TransactionID: "102", WebOrderLineItemID: "11", PurchaseDateMS: 1530403200000, ExpiresDateMS: 1532995200000},
+			},
+			false,
+		},
+		"MultipleAccounts": {
+			InApps{
+				{ProductID: "monthly", OriginalTransactionID: "1", WebOrderLineItemID: "10", PurchaseDateMS: 1527811200000, ExpiresDateMS: 1530403200000},
+				{ProductID: "monthly", OriginalTransactionID: "2", WebOrderLineItemID: "20", PurchaseDateMS: 1529020800000, ExpiresDateMS: 1531612800000},
+			},
+			true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.inapps.HasMultipleAccounts(); got != tc.want {
+				t.Errorf("InApps.HasMultipleAccounts() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDetectSharedOriginalTransaction(t *testing.T) {
+	shared := InApp{ProductID: "monthly", TransactionID: "11", OriginalTransactionID: "10", PurchaseDateMS: 1527811200000}
+	responses := map[string]*ValidationResponse{
+		"alice": {LatestReceiptInfo: InApps{shared, {ProductID: "monthly", TransactionID: "21", OriginalTransactionID: "20"}}},
+		"bob":   {Receipt: Receipt{InApp: InApps{shared}}},
+		"carol": {LatestReceiptInfo: InApps{{ProductID: "yearly", TransactionID: "31", OriginalTransactionID: "30"}}},
+		"dave":  nil,
+	}
+
+	want := []SharedUse{{OriginalTransactionID: "10", UserIDs: []string{"alice", "bob"}}}
+	if got := DetectSharedOriginalTransaction(responses); !reflect.DeepEqual(got, want) {
+		t.Errorf("DetectSharedOriginalTransaction() = %+v, want %+v", got, want)
+	}
+
+	delete(responses, "bob")
+	if got := DetectSharedOriginalTransaction(responses); len(got) != 0 {
+		t.Errorf("DetectSharedOriginalTransaction() = %+v, want none", got)
+	}
+}
@@ -0,0 +1,63 @@
+package ios
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ProcessedTransactions interface represents the storage of transactions, which were already granted to the user.
+// It's used to prevent granting the same consumable purchase twice.
+type ProcessedTransactions interface {
+	// Seen returns true if transaction with the given id was already processed.
+	Seen(transactionID string) (bool, error)
+	// Mark marks the transaction with the given id as processed.
+	Mark(transactionID string) error
+}
+
+// MemoryProcessedTransactions type represents in-memory implementation of ProcessedTransactions interface.
+// It's safe for concurrent use, but keeps the state only during the process lifetime.
+type MemoryProcessedTransactions struct {
+	mu   sync.RWMutex
+	seen map[string]struct{}
+}
+
+// NewMemoryProcessedTransactions return a new instance of MemoryProcessedTransactions type.
+func NewMemoryProcessedTransactions() *MemoryProcessedTransactions {
+	return &MemoryProcessedTransactions{seen: make(map[string]struct{})}
+}
+
+// Seen returns true if transaction with the given id was already marked as processed.
+func (m *MemoryProcessedTransactions) Seen(transactionID string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.seen[transactionID]
+	return ok, nil
+}
+
+// Mark marks the transaction with the given id as processed.
+func (m *MemoryProcessedTransactions) Mark(transactionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.seen[transactionID] = struct{}{}
+	return nil
+}
+
+// UngrantedConsumables returns consumable transactions from the receipt, which weren't processed yet
+// according to the given store. The method doesn't mark returned transactions as processed,
+// the caller should call store.Mark() after granting the purchase to the user.
+func (r *ValidationResponse) UngrantedConsumables(store ProcessedTransactions) (InApps, error) {
+	var ungranted InApps
+	for _, inapp := range r.Receipt.InApp {
+		if !inapp.IsConsumable() {
+			continue
+		}
+		seen, err := store.Seen(inapp.TransactionID)
+		if err != nil {
+			return nil, fmt.Errorf("can't check transaction %s: %v", inapp.TransactionID, err)
+		}
+		if !seen {
+			ungranted = append(ungranted, inapp)
+		}
+	}
+	return ungranted, nil
+}
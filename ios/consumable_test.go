@@ -0,0 +1,46 @@
+package ios
+
+import (
+	"errors"
+	"testing"
+)
+
+type failingProcessedTransactions struct{}
+
+func (failingProcessedTransactions) Seen(string) (bool, error) {
+	return false, errors.New("storage failure")
+}
+func (failingProcessedTransactions) Mark(string) error { return errors.New("storage failure") }
+
+func TestValidationResponse_UngrantedConsumables(t *testing.T) {
+	response := ValidationResponse{
+		Receipt: Receipt{
+			InApp: InApps{
+				{ProductID: "coins", TransactionID: "1"},
+				{ProductID: "coins", TransactionID: "2"},
+				{ProductID: "monthly", TransactionID: "3", ExpiresDateMS: 1527811200000, WebOrderLineItemID: "100"},
+			},
+		},
+	}
+
+	t.Run("OnlyUnmarked", func(t *testing.T) {
+		store := NewMemoryProcessedTransactions()
+		if err := store.Mark("1"); err != nil {
+			t.Fatalf("MemoryProcessedTransactions.Mark() error = %v", err)
+		}
+
+		got, err := response.UngrantedConsumables(store)
+		if err != nil {
+			t.Fatalf("ValidationResponse.UngrantedConsumables() error = %v", err)
+		}
+		if len(got) != 1 || got[0].TransactionID != "2" {
+			t.Errorf("ValidationResponse.UngrantedConsumables() = %v, want only transaction 2", got)
+		}
+	})
+
+	t.Run("StoreError", func(t *testing.T) {
+		if _, err := response.UngrantedConsumables(failingProcessedTransactions{}); err == nil {
+			t.Errorf("ValidationResponse.UngrantedConsumables() should return error it this case")
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package ios
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AppleTime type represents human-readable Apple date fields, like purchase_date or purchase_date_pst,
+// which look like "2013-08-01 07:00:00 Etc/GMT" or "2013-08-01 00:00:00 America/Los_Angeles".
+// The date is parsed on decoding, while the raw string is preserved and marshaled back unchanged.
+//
+// Parsing is tolerant: extra spaces are ignored, a date without time zone is considered GMT,
+// and a number of milliseconds, which iOS 6 style receipts use, is accepted as well.
+// A date, which still can't be parsed, doesn't fail the decoding: Time stays zero and Raw keeps the value.
+//
+// Structs of this package hold AppleTime by pointer, so an absent date is nil and omitted on marshaling.
+type AppleTime struct {
+	Time time.Time
+	Raw  string
+}
+
+// String returns the raw string of the date.
+func (t AppleTime) String() string {
+	return t.Raw
+}
+
+// IsZero returns true if the date is absent or can't be parsed.
+func (t AppleTime) IsZero() bool {
+	return t.Time.IsZero()
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (t *AppleTime) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*t = AppleTime{}
+		return nil
+	}
+
+	raw := string(b)
+	if strings.HasPrefix(raw, `"`) {
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return fmt.Errorf("can't unmarshal apple time: %v", err)
+		}
+	}
+
+	*t = AppleTime{Raw: raw}
+	if parsed, err := parseAppleTime(raw); err == nil {
+		t.Time = parsed
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler interface.
+// The raw string is used if present, otherwise the time is formatted in GMT.
+func (t AppleTime) MarshalJSON() ([]byte, error) {
+	raw := t.Raw
+	if raw == "" && !t.Time.IsZero() {
+		raw = t.Time.UTC().Format(appleDateLayout) + " Etc/GMT"
+	}
+	return json.Marshal(raw)
+}
+
+// parse returns the parsed time or parses the raw string, which is the case
+// when AppleTime wasn't decoded from JSON, to report the parsing error.
+// An absent date is parsed as the empty string.
+func (t *AppleTime) parse() (time.Time, error) {
+	if t == nil {
+		return parseAppleDate("")
+	}
+	if !t.Time.IsZero() {
+		return t.Time, nil
+	}
+	return parseAppleDate(t.Raw)
+}
+
+// parseAppleTime is the tolerant version of parseAppleDate.
+func parseAppleTime(date string) (time.Time, error) {
+	fields := strings.Fields(date)
+	switch len(fields) {
+	case 1:
+		ms, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("can't parse date %q: %v", date, err)
+		}
+		return convertToTime(ms), nil
+	case 2:
+		fields = append(fields, "Etc/GMT")
+	}
+	return parseAppleDate(strings.Join(fields, " "))
+}
@@ -0,0 +1,108 @@
+package ios
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestAppleTime_UnmarshalJSON(t *testing.T) {
+	want := time.Date(2013, 8, 1, 7, 0, 0, 0, time.UTC)
+
+	type args struct {
+		data string
+	}
+	type test struct {
+		args args
+		want time.Time
+		raw  string
+	}
+
+	tests := map[string]test{
+		"Production":   {args{data: `"2013-08-01 07:00:00 Etc/GMT"`}, want, "2013-08-01 07:00:00 Etc/GMT"},
+		"SandboxPST":   {args{data: `"2013-08-01 00:00:00 America/Los_Angeles"`}, want, "2013-08-01 00:00:00 America/Los_Angeles"},
+		"SpacePadded":  {args{data: `" 2013-08-01  07:00:00   Etc/GMT "`}, want, " 2013-08-01  07:00:00   Etc/GMT "},
+		"WithoutZone":  {args{data: `"2013-08-01 07:00:00"`}, want, "2013-08-01 07:00:00"},
+		"Milliseconds": {args{data: `"1375340400000"`}, want, "1375340400000"},
+		"Malformed":    {args{data: `"yesterday"`}, time.Time{}, "yesterday"},
+		"Null":         {args{data: `null`}, time.Time{}, ""},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var got AppleTime
+			if err := json.Unmarshal([]byte(tc.args.data), &got); err != nil {
+				t.Fatalf("AppleTime.UnmarshalJSON() error = %v", err)
+			}
+			if !got.Time.Equal(tc.want) || got.Raw != tc.raw {
+				t.Errorf("AppleTime.UnmarshalJSON() = (%v, %q), want (%v, %q)", got.Time, got.Raw, tc.want, tc.raw)
+			}
+		})
+	}
+}
+
+func TestAppleTime_InApp(t *testing.T) {
+	data := `{"purchase_date":"2013-08-01 07:00:00 Etc/GMT","purchase_date_ms":"1375340400000",` +
+		`"purchase_date_pst":"2013-08-01 00:00:00 America/Los_Angeles"}`
+
+	var inapp InApp
+	if err := json.Unmarshal([]byte(data), &inapp); err != nil {
+		t.Fatalf("can't unmarshal in-app purchase: %v", err)
+	}
+	if ms := convertToTime(inapp.PurchaseDateMS); !inapp.PurchaseDate.Time.Equal(ms) || !inapp.PurchaseDatePST.Time.Equal(ms) {
+		t.Errorf("InApp purchase dates = (%v, %v), want %v", inapp.PurchaseDate.Time, inapp.PurchaseDatePST.Time, ms)
+	}
+
+	b, err := json.Marshal(inapp.PurchaseDatePST)
+	if err != nil {
+		t.Fatalf("AppleTime.MarshalJSON() error = %v", err)
+	}
+	if got, want := string(b), `"2013-08-01 00:00:00 America/Los_Angeles"`; got != want {
+		t.Errorf("AppleTime.MarshalJSON() = %v, want %v", got, want)
+	}
+}
+
+func TestAppleTime_MarshalAbsent(t *testing.T) {
+	type test struct {
+		value interface{}
+		want  string
+	}
+
+	tests := map[string]test{
+		"InApp": {
+			&InApp{ProductID: "p"},
+			`{"quantity":"","product_id":"p","transaction_id":"","original_transaction_id":"",` +
+				`"is_trial_period":"false","is_in_intro_offer_period":"false","app_item_id":"",` +
+				`"version_external_identifier":"","auto_renew_status":"","auto_renew_product_id":""}`,
+		},
+		"Receipt": {&Receipt{BundleID: "b"}, `{"bundle_id":"b"}`},
+		"Notification": {
+			&Notification{NotificationType: NotificationCancel},
+			`{"notification_type":"CANCEL","password":"","environment":"","unified_receipt":{"status":0}}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			b, err := json.Marshal(tc.value)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			if string(b) != tc.want {
+				t.Errorf("json.Marshal() = %s, want %s", b, tc.want)
+			}
+
+			// Absent dates stay absent after the round trip.
+			if err := json.Unmarshal(b, tc.value); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			again, err := json.Marshal(tc.value)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			if string(again) != tc.want {
+				t.Errorf("json.Marshal() after round trip = %s, want %s", again, tc.want)
+			}
+		})
+	}
+}
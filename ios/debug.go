@@ -0,0 +1,42 @@
+package ios
+
+import (
+	"sync"
+)
+
+// responseRing type represents the bounded ring buffer of raw response bodies.
+// It's safe for concurrent use.
+type responseRing struct {
+	mu        sync.Mutex
+	responses [][]byte
+	next      int
+	full      bool
+}
+
+// newResponseRing return a new instance of responseRing type, which keeps the last n responses.
+func newResponseRing(n int) *responseRing {
+	return &responseRing{responses: make([][]byte, n)}
+}
+
+// push adds the copy of the response body to the buffer, evicting the oldest one when the buffer is full.
+func (r *responseRing) push(body []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.responses[r.next] = append([]byte(nil), body...)
+	r.next = (r.next + 1) % len(r.responses)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// list returns the captured responses from the oldest to the newest.
+func (r *responseRing) list() [][]byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return append([][]byte(nil), r.responses[:r.next]...)
+	}
+	return append(append([][]byte(nil), r.responses[r.next:]...), r.responses[:r.next]...)
+}
@@ -0,0 +1,61 @@
+package ios
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestResponseRing(t *testing.T) {
+	ring := newResponseRing(2)
+	if got := ring.list(); len(got) != 0 {
+		t.Errorf("responseRing.list() = %q, want empty", got)
+	}
+
+	ring.push([]byte("1"))
+	if got, want := ring.list(), [][]byte{[]byte("1")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("responseRing.list() = %q, want %q", got, want)
+	}
+
+	ring.push([]byte("2"))
+	ring.push([]byte("3"))
+	if got, want := ring.list(), [][]byte{[]byte("2"), []byte("3")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("responseRing.list() = %q, want %q", got, want)
+	}
+}
+
+func TestValidator_LastResponses(t *testing.T) {
+	var status int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status++
+		fmt.Fprintf(w, `{"status":%d}`, status)
+	}))
+	defer server.Close()
+
+	t.Run("Disabled", func(t *testing.T) {
+		v := NewValidator()
+		if _, err := v.Validate(context.Background(), "receipt", testEnv(server.URL)); err != nil {
+			t.Fatalf("Validator.Validate() error = %v", err)
+		}
+		if got := v.LastResponses(); got != nil {
+			t.Errorf("Validator.LastResponses() = %q, want nil", got)
+		}
+	})
+
+	t.Run("Enabled", func(t *testing.T) {
+		v := NewValidator(WithDebugCapture(2))
+		for n := 0; n < 3; n++ {
+			if _, err := v.Validate(context.Background(), "receipt", testEnv(server.URL)); err != nil {
+				t.Fatalf("Validator.Validate() error = %v", err)
+			}
+		}
+
+		want := [][]byte{[]byte(`{"status":3}`), []byte(`{"status":4}`)}
+		if got := v.LastResponses(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Validator.LastResponses() = %q, want %q", got, want)
+		}
+	})
+}
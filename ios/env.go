@@ -1,13 +1,15 @@
 package ios
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 const (
-	prodURL = "https://sandbox.itunes.apple.com/verifyReceipt"
-	sandURL = "https://buy.itunes.apple.com/verifyReceipt"
+	prodURL = "https://buy.itunes.apple.com/verifyReceipt"
+	sandURL = "https://sandbox.itunes.apple.com/verifyReceipt"
 )
 
 // Env interface provide ability to choose an environment for validation in-app purchases.
@@ -20,6 +22,23 @@ type Env interface {
 	Endpoint() string
 }
 
+// ContextEnv represents the Env, which endpoint depends on the request context,
+// for example on the tenant or the region stored in the context by a middleware.
+// Validator uses EndpointContext instead of Endpoint for such environments.
+type ContextEnv interface {
+	Env
+	// EndpointContext returns endpoint URL for the given context.
+	EndpointContext(ctx context.Context) string
+}
+
+// resolveEndpoint returns the endpoint URL of the env for the given context.
+func resolveEndpoint(ctx context.Context, env Env) string {
+	if ce, ok := env.(ContextEnv); ok {
+		return ce.EndpointContext(ctx)
+	}
+	return env.Endpoint()
+}
+
 // AppleEnv represents enumeration of Apple environments for validation in-app purchases.
 type AppleEnv int
 
@@ -30,6 +49,19 @@ const (
 	Sandbox
 )
 
+// ParseEnv return AppleEnv by its case-insensitive name: "production" or "prod" for Production,
+// "sandbox" or "sand" for Sandbox. It's useful for environments stored in configuration files.
+func ParseEnv(name string) (AppleEnv, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "production", "prod":
+		return Production, nil
+	case "sandbox", "sand":
+		return Sandbox, nil
+	default:
+		return Production, fmt.Errorf("unknown environment name: %q", name)
+	}
+}
+
 func (e AppleEnv) Endpoint() string {
 	envs := map[AppleEnv]string{
 		Production: prodURL,
@@ -57,10 +89,10 @@ func (e *AppleEnv) UnmarshalJSON(b []byte) error {
 	}
 
 	switch env {
-	case "0":
+	case "0", "Production":
 		*e = Production
 		return nil
-	case "1":
+	case "1", "Sandbox":
 		*e = Sandbox
 		return nil
 	default:
@@ -71,3 +103,17 @@ func (e *AppleEnv) UnmarshalJSON(b []byte) error {
 func (e AppleEnv) MarshalJSON() ([]byte, error) {
 	return []byte(`"` + e.String() + `"`), nil
 }
+
+// Endpoint return the Env, which sends requests to the given URL instead of Apple environments,
+// for example to a local proxy, which mirrors the App Store verifyReceipt API in integration tests.
+// It's accepted everywhere Production and Sandbox are.
+func Endpoint(url string) Env {
+	return urlEnv(url)
+}
+
+// urlEnv type implements Env interface and represents the custom endpoint URL.
+type urlEnv string
+
+func (e urlEnv) Endpoint() string {
+	return string(e)
+}
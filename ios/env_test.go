@@ -1,6 +1,10 @@
 package ios
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -11,8 +15,9 @@ func TestEndpoint_Endpoint(t *testing.T) {
 	}
 
 	tests := map[string]args{
-		"Production": {want: prodURL, env: Production},
-		"Sandbox":    {want: sandURL, env: Sandbox},
+		"Production": {want: "https://buy.itunes.apple.com/verifyReceipt", env: Production},
+		"Sandbox":    {want: "https://sandbox.itunes.apple.com/verifyReceipt", env: Sandbox},
+		"Custom":     {want: "http://localhost:8080/verifyReceipt", env: Endpoint("http://localhost:8080/verifyReceipt")},
 	}
 
 	for name, tt := range tests {
@@ -56,8 +61,10 @@ func TestAppleEnv_UnmarshalJSON(t *testing.T) {
 		want AppleEnv
 	}
 	tests := map[string]test{
-		"Production": {args{env: []byte(`"0"`)}, Production},
-		"Sandbox":    {args{env: []byte(`"1"`)}, Sandbox},
+		"Production":       {args{env: []byte(`"0"`)}, Production},
+		"Sandbox":          {args{env: []byte(`"1"`)}, Sandbox},
+		"ProductionString": {args{env: []byte(`"Production"`)}, Production},
+		"SandboxString":    {args{env: []byte(`"Sandbox"`)}, Sandbox},
 	}
 
 	var env AppleEnv
@@ -79,3 +86,87 @@ func TestAppleEnv_UnmarshalJSON(t *testing.T) {
 		}
 	})
 }
+
+func TestParseEnv(t *testing.T) {
+	type args struct {
+		name string
+	}
+	type test struct {
+		args args
+		want AppleEnv
+	}
+
+	tests := map[string]test{
+		"production": {args{name: "production"}, Production},
+		"Production": {args{name: "Production"}, Production},
+		"prod":       {args{name: "prod"}, Production},
+		"PROD":       {args{name: "PROD"}, Production},
+		"sandbox":    {args{name: "sandbox"}, Sandbox},
+		"Sandbox":    {args{name: "Sandbox"}, Sandbox},
+		"sand":       {args{name: "sand"}, Sandbox},
+		"SAND":       {args{name: " SAND "}, Sandbox},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseEnv(tc.args.name)
+			if err != nil {
+				t.Fatalf("ParseEnv() error = %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("ParseEnv() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("Error", func(t *testing.T) {
+		if _, err := ParseEnv("staging"); err == nil {
+			t.Errorf("ParseEnv() should return error it this case")
+		}
+	})
+}
+
+func TestEndpoint_Validate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":0,"latest_receipt":"proxied"}`)
+	}))
+	defer server.Close()
+
+	resp, err := NewValidator(WithDefaultEnv(Endpoint(server.URL))).ValidateDefault(context.Background(), "receipt")
+	if err != nil {
+		t.Fatalf("Validator.ValidateDefault() error = %v", err)
+	}
+	if resp.LatestReceipt != "proxied" {
+		t.Errorf("Validator.ValidateDefault() latest receipt = %q, want the response of the custom endpoint", resp.LatestReceipt)
+	}
+}
+
+// hostRecorder type implements http.RoundTripper and used to record the requested hosts
+// before the requests are redirected by the next transport.
+type hostRecorder struct {
+	hosts []string
+	next  http.RoundTripper
+}
+
+func (r *hostRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.hosts = append(r.hosts, req.URL.Host)
+	return r.next.RoundTrip(req)
+}
+
+func TestValidator_ValidateAuto_ProductionFirst(t *testing.T) {
+	server, _ := NewTestServer(map[string]ValidationResponse{"receipt": {Status: 0, Environment: Production}})
+	defer server.Close()
+
+	transport := routeTransport{}
+	transport.route(t, Production, server.URL)
+	transport.route(t, Sandbox, server.URL)
+	recorder := &hostRecorder{next: transport}
+
+	v := NewValidator(WithHTTPClient(&http.Client{Transport: recorder}))
+	if _, err := v.ValidateAuto(context.Background(), "receipt"); err != nil {
+		t.Fatalf("Validator.ValidateAuto() error = %v", err)
+	}
+	if len(recorder.hosts) != 1 || recorder.hosts[0] != "buy.itunes.apple.com" {
+		t.Errorf("Validator.ValidateAuto() requested %v, want buy.itunes.apple.com only", recorder.hosts)
+	}
+}
@@ -0,0 +1,108 @@
+package ios
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// defaultNotificationFormField is the name of the form field, which contains JSON notification
+// when it's delivered as application/x-www-form-urlencoded payload.
+const defaultNotificationFormField = "notification"
+
+// NotificationHandler type implements http.Handler and used to receive App Store server notifications.
+//
+// The notification is accepted either as application/json body or as application/x-www-form-urlencoded body
+// with JSON notification in the FormField field. Any other content type is rejected with 415 status code.
+type NotificationHandler struct {
+	// Handle is invoked with every successfully decoded notification.
+	// Returning an error makes the handler respond with 500 status code,
+	// so the App Store will retry the notification later.
+	Handle func(ctx context.Context, n *Notification) error
+	// FormField is the name of the form field with JSON notification for form-encoded payloads.
+	// If empty, the "notification" field is used.
+	FormField string
+	// Password is the shared secret, which the notification must contain. Notifications with other password
+	// are rejected with 401 status code and generic body, the submitted password is never echoed or logged.
+	// If empty, the password isn't checked.
+	Password string
+	// ErrorLog specifies an optional logger for rejected notifications and Handle errors.
+	// If nil, logging is done via the log package's standard logger.
+	// Passwords are redacted in logged lines.
+	ErrorLog *log.Logger
+}
+
+func (h *NotificationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, status := h.payload(r)
+	if status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	var notification Notification
+	if err := json.NewDecoder(body).Decode(&notification); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	if h.Password != "" && subtle.ConstantTimeCompare([]byte(notification.Password), []byte(h.Password)) != 1 {
+		h.logf(&notification, "notification %s rejected: %v", notification.NotificationType, ErrWrongNotificationPassword)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.Handle(r.Context(), &notification); err != nil {
+		h.logf(&notification, "notification %s handling error: %v", notification.NotificationType, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// logf logs the message with the submitted and the expected passwords redacted.
+func (h *NotificationHandler) logf(n *Notification, format string, args ...interface{}) {
+	msg := redactString(fmt.Sprintf(format, args...), "", n.Password)
+	msg = redactString(msg, "", h.Password)
+	if h.ErrorLog != nil {
+		h.ErrorLog.Print(msg)
+		return
+	}
+	log.Print(msg)
+}
+
+// payload returns the reader of JSON notification according to the request content type
+// or the http status code, which should be returned to the client.
+func (h *NotificationHandler) payload(r *http.Request) (io.Reader, int) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, http.StatusUnsupportedMediaType
+	}
+
+	switch mediaType {
+	case "application/json":
+		return r.Body, http.StatusOK
+	case "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			return nil, http.StatusBadRequest
+		}
+		field := h.FormField
+		if field == "" {
+			field = defaultNotificationFormField
+		}
+		return strings.NewReader(r.PostForm.Get(field)), http.StatusOK
+	default:
+		return nil, http.StatusUnsupportedMediaType
+	}
+}
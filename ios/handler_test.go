@@ -0,0 +1,147 @@
+package ios
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testPassword is the shared secret of test notifications, which looks like the real App Store one.
+const testPassword = "2d6e1c0a5b9f4e38a7c3d1f0b8e6a4c2"
+
+const testNotification = `{"notification_type":"DID_RENEW","password":"` + testPassword + `","environment":"PROD","auto_renew_product_id":"monthly","auto_renew_status":"true"}`
+
+func TestNotificationHandler_ServeHTTP(t *testing.T) {
+	want := Notification{
+		NotificationType:   NotificationDidRenew,
+		Password:           testPassword,
+		Environment:        "PROD",
+		AutoRenewProductId: "monthly",
+		AutoRenewStatus:    "true",
+	}
+
+	type args struct {
+		contentType string
+		body        string
+	}
+	type test struct {
+		args       args
+		wantStatus int
+	}
+
+	tests := map[string]test{
+		"JSON": {
+			args{contentType: "application/json; charset=utf-8", body: testNotification},
+			http.StatusOK,
+		},
+		"Form": {
+			args{
+				contentType: "application/x-www-form-urlencoded",
+				body:        url.Values{"notification": {testNotification}}.Encode(),
+			},
+			http.StatusOK,
+		},
+		"UnsupportedMediaType": {
+			args{contentType: "text/plain", body: testNotification},
+			http.StatusUnsupportedMediaType,
+		},
+		"MalformedJSON": {
+			args{contentType: "application/json", body: `{"notification_type":`},
+			http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var got *Notification
+			handler := &NotificationHandler{Handle: func(ctx context.Context, n *Notification) error {
+				got = n
+				return nil
+			}}
+
+			req := httptest.NewRequest(http.MethodPost, "/notifications", strings.NewReader(tc.args.body))
+			req.Header.Set("Content-Type", tc.args.contentType)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("NotificationHandler.ServeHTTP() status = %v, want %v", rec.Code, tc.wantStatus)
+			}
+			if tc.wantStatus == http.StatusOK && !reflect.DeepEqual(*got, want) {
+				t.Errorf("NotificationHandler.ServeHTTP() decoded %+v, want %+v", *got, want)
+			}
+		})
+	}
+
+	t.Run("HandleError", func(t *testing.T) {
+		handler := &NotificationHandler{Handle: func(ctx context.Context, n *Notification) error {
+			return errors.New("storage failure")
+		}}
+
+		req := httptest.NewRequest(http.MethodPost, "/notifications", strings.NewReader(testNotification))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("NotificationHandler.ServeHTTP() status = %v, want %v", rec.Code, http.StatusInternalServerError)
+		}
+	})
+}
+
+func TestNotificationHandler_ServeHTTP_WrongPassword(t *testing.T) {
+	const submitted = "9f86d081884c7d659a2feaa0c55ad015"
+
+	var logs strings.Builder
+	var handled bool
+	handler := &NotificationHandler{
+		Password: testPassword,
+		ErrorLog: log.New(&logs, "", 0),
+		Handle: func(ctx context.Context, n *Notification) error {
+			handled = true
+			return nil
+		},
+	}
+
+	body := strings.Replace(testNotification, `"password":"`+testPassword+`"`, `"password":"`+submitted+`"`, 1)
+	req := httptest.NewRequest(http.MethodPost, "/notifications", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized || handled {
+		t.Errorf("NotificationHandler.ServeHTTP() status = %v, handled = %v, want %v and false", rec.Code, handled, http.StatusUnauthorized)
+	}
+	if strings.Contains(rec.Body.String(), submitted) {
+		t.Errorf("NotificationHandler.ServeHTTP() body = %q contains the submitted password", rec.Body.String())
+	}
+	if logs.Len() == 0 || strings.Contains(logs.String(), submitted) || strings.Contains(logs.String(), testPassword) {
+		t.Errorf("NotificationHandler.ServeHTTP() logged %q, want a line without passwords", logs.String())
+	}
+
+	t.Run("HandleError", func(t *testing.T) {
+		logs.Reset()
+		handler.Handle = func(ctx context.Context, n *Notification) error {
+			return fmt.Errorf("can't process notification with password %s", n.Password)
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/notifications", strings.NewReader(testNotification))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("NotificationHandler.ServeHTTP() status = %v, want %v", rec.Code, http.StatusInternalServerError)
+		}
+		if logs.Len() == 0 || strings.Contains(logs.String(), testPassword) {
+			t.Errorf("NotificationHandler.ServeHTTP() logged %q, want a line without password", logs.String())
+		}
+	})
+}
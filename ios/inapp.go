@@ -1,6 +1,12 @@
 package ios
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
 	"time"
 )
 
@@ -54,22 +60,22 @@ type InApp struct {
 	// For a transaction that restores a previous transaction, the purchase date is the same as the original purchase date. Use Original Purchase Date to get the date of the original transaction.
 	// In an auto-renewable subscription receipt, the purchase date is the date when the subscription was either purchased or renewed (with or without a lapse).
 	// For an automatic renewal that occurs on the expiration date of the current period, the purchase date is the start date of the next period, which is identical to the end date of the current period.
-	PurchaseDate    string `json:"purchase_date,omitempty"`
-	PurchaseDateMS  int64  `json:"purchase_date_ms,omitempty,string"`
-	PurchaseDatePST string `json:"purchase_date_pst,omitempty"`
+	PurchaseDate    *AppleTime `json:"purchase_date,omitempty"`
+	PurchaseDateMS  int64      `json:"purchase_date_ms,omitempty,string"`
+	PurchaseDatePST *AppleTime `json:"purchase_date_pst,omitempty"`
 	// For a transaction that restores a previous transaction, the date of the original transaction.
 	// In an auto-renewable subscription receipt, this indicates the beginning of the subscription period, even if the subscription has been renewed.
-	OriginalPurchaseDate    string `json:"original_purchase_date,omitempty"`
-	OriginalPurchaseDateMS  int64  `json:"original_purchase_date_ms,omitempty,string"`
-	OriginalPurchaseDatePST string `json:"original_purchase_date_pst,omitempty"`
+	OriginalPurchaseDate    *AppleTime `json:"original_purchase_date,omitempty"`
+	OriginalPurchaseDateMS  int64      `json:"original_purchase_date_ms,omitempty,string"`
+	OriginalPurchaseDatePST *AppleTime `json:"original_purchase_date_pst,omitempty"`
 	// The expiration date for the subscription, expressed as the number of milliseconds since January 1, 1970, 00:00:00 GMT.
 	// This key is only present for auto-renewable subscription receipts. Use this value to identify the date when the subscription will renew or expire, to determine if a customer should have access to content or service.
 	// After validating the latest receipt, if the subscription expiration date for the latest renewal transaction is a past date, it is safe to assume that the subscription has expired.
-	ExpiresDate             string `json:"expires_date,omitempty"`
-	ExpiresDateMS           int64  `json:"expires_date_ms,omitempty,string"`
-	ExpiresDatePST          string `json:"expires_date_pst,omitempty"`
-	ExpiresDateFormatted    string `json:"expires_date_formatted,omitempty"`
-	ExpiresDateFormattedPST string `json:"expires_date_formatted_pst,omitempty"`
+	ExpiresDate             *AppleTime `json:"expires_date,omitempty"`
+	ExpiresDateMS           int64      `json:"expires_date_ms,omitempty,string"`
+	ExpiresDatePST          *AppleTime `json:"expires_date_pst,omitempty"`
+	ExpiresDateFormatted    *AppleTime `json:"expires_date_formatted,omitempty"`
+	ExpiresDateFormattedPST *AppleTime `json:"expires_date_formatted_pst,omitempty"`
 	// For an expired subscription, the reason for the subscription expiration.
 	// “1” — Customer canceled their subscription.
 	// “2” — Billing error; for example customer’s payment information was no longer valid.
@@ -104,9 +110,9 @@ type InApp struct {
 	// Note: A canceled in-app purchase remains in the receipt indefinitely.
 	// Only applicable if the refund was for a non-consumable product, an auto-renewable subscription,
 	// a non-renewing subscription, or for a free subscription.
-	CancellationDate    string `json:"cancellation_date,omitempty"`
-	CancellationDateMS  int64  `json:"cancellation_date_ms,omitempty,string"`
-	CancellationDatePST string `json:"cancellation_date_pst,omitempty"`
+	CancellationDate    *AppleTime `json:"cancellation_date,omitempty"`
+	CancellationDateMS  int64      `json:"cancellation_date_ms,omitempty,string"`
+	CancellationDatePST *AppleTime `json:"cancellation_date_pst,omitempty"`
 	// For a transaction that was canceled, the reason for cancellation.
 	// “1” - Customer canceled their transaction due to an actual or perceived issue within your app.
 	// “0” - Transaction was canceled for another reason, for example, if the customer made the purchase accidentally.
@@ -142,14 +148,18 @@ type InApp struct {
 	// This key is only present for auto-renewable subscription receipts if the subscription price was increased without keeping the existing price for active subscribers.
 	// You can use this value to track customer adoption of the new price and take appropriate action.
 	PriceConsentStatus string `json:"price_consent_status,omitempty"`
+	// The identifier of the subscription offer redeemed by the user.
+	// This key is only present for auto-renewable subscription receipts, which were purchased with a promotional offer.
+	PromotionalOfferIdentifier string `json:"promotional_offer_id,omitempty"`
+	// The identifier of the subscription group to which the subscription belongs.
+	// This key is only present for auto-renewable subscription receipts.
+	SubscriptionGroupIdentifier string `json:"subscription_group_identifier,omitempty"`
 }
 
-// LatestInApp return latest element from an array of InApp sorted by OriginalPurchaseDate
+// LatestInApp return the most recently purchased element from an array of InApp.
+// The array itself isn't changed.
 func (i InApps) LatestInApp() *InApp {
-	if len(i) <= 0 {
-		return nil
-	}
-	return &i.Sorted(ByOriginalPurchaseDate)[0]
+	return i.MostRecent(ByPurchaseDate)
 }
 
 // Len return the length of InApps array
@@ -157,9 +167,132 @@ func (i InApps) Len() int {
 	return len(i)
 }
 
-// Expired return true if expiration date was before current date
+// Merge return the union of both arrays without duplicates sorted by purchase date.
+// Elements are matched by TransactionID, on conflict the element with the later purchase date is kept.
+// Neither of arrays is changed.
+func (i InApps) Merge(other InApps) InApps {
+	index := make(map[string]int, len(i)+len(other))
+	merged := make(InApps, 0, len(i)+len(other))
+	for _, inapp := range append(append(InApps(nil), i...), other...) {
+		n, ok := index[inapp.TransactionID]
+		if !ok {
+			index[inapp.TransactionID] = len(merged)
+			merged = append(merged, inapp)
+			continue
+		}
+		if inapp.PurchaseDateMS > merged[n].PurchaseDateMS {
+			merged[n] = inapp
+		}
+	}
+	return merged.Sorted(ByPurchaseDate)
+}
+
+// filter return a new InApps array which contains only elements satisfying the fn
+func (i InApps) filter(fn func(InApp) bool) InApps {
+	var filtered InApps
+	for _, inapp := range i {
+		if fn(inapp) {
+			filtered = append(filtered, inapp)
+		}
+	}
+	return filtered
+}
+
+// groupByProduct return the elements grouped by product in the order of the first appearance of the product
+func (i InApps) groupByProduct() []InApps {
+	var groups []InApps
+	index := make(map[string]int)
+	for _, inapp := range i {
+		n, ok := index[inapp.ProductID]
+		if !ok {
+			n = len(groups)
+			index[inapp.ProductID] = n
+			groups = append(groups, nil)
+		}
+		groups[n] = append(groups[n], inapp)
+	}
+	return groups
+}
+
+// latestByProduct return the most recently purchased element of each product
+// in the order of the first appearance of the product
+func (i InApps) latestByProduct() InApps {
+	var products []string
+	latest := make(map[string]InApp)
+	for _, inapp := range i {
+		current, ok := latest[inapp.ProductID]
+		if !ok {
+			products = append(products, inapp.ProductID)
+		}
+		if !ok || inapp.PurchaseDateMS > current.PurchaseDateMS {
+			latest[inapp.ProductID] = inapp
+		}
+	}
+
+	result := make(InApps, 0, len(products))
+	for _, product := range products {
+		result = append(result, latest[product])
+	}
+	return result
+}
+
+// subscriptions return a new InApps array without consumables, which Apple occasionally puts
+// into the latest receipt info. Subscription helpers use it, since a transaction without expiration date
+// and auto-renewable subscription fields would be taken for the latest, long expired, subscription.
+func (i InApps) subscriptions() InApps {
+	return i.filter(func(inapp InApp) bool { return !inapp.IsConsumable() })
+}
+
+// byProduct return a new InApps array which contains only elements of the given product
+func (i InApps) byProduct(productID string) InApps {
+	return i.filter(func(inapp InApp) bool { return inapp.ProductID == productID })
+}
+
+// Expired return true if expiration date was before current date.
+// Purchases without expiration date, like consumables and non-consumables, never expire.
 func (i InApp) Expired() bool {
-	return convertToTime(i.ExpiresDateMS).Before(time.Now())
+	return i.expiredAt(timeNow())
+}
+
+// expiredAt return true if the subscription is expired at the given time.
+func (i InApp) expiredAt(t time.Time) bool {
+	if i.ExpiresDateMS == 0 {
+		return false
+	}
+	return convertToTime(i.ExpiresDateMS).Before(t)
+}
+
+// PurchaseTime return the purchase date as time.Time in UTC or zero time.Time if the date is absent.
+func (i InApp) PurchaseTime() time.Time {
+	return convertToTime(i.PurchaseDateMS)
+}
+
+// OriginalPurchaseTime return the original purchase date as time.Time in UTC
+// or zero time.Time if the date is absent.
+func (i InApp) OriginalPurchaseTime() time.Time {
+	return convertToTime(i.OriginalPurchaseDateMS)
+}
+
+// ExpiresTime return the subscription expiration date as time.Time in UTC
+// or zero time.Time if the purchase has no expiration date.
+func (i InApp) ExpiresTime() time.Time {
+	return convertToTime(i.ExpiresDateMS)
+}
+
+// CancellationTime return the date of refund or cancellation by Apple support as time.Time in UTC
+// or zero time.Time if the purchase wasn't canceled.
+func (i InApp) CancellationTime() time.Time {
+	return convertToTime(i.CancellationDateMS)
+}
+
+// ParsePurchaseDateString parse human-readable PurchaseDate field to Go time.Time.
+// It's useful when PurchaseDateMS field is absent, for example in older receipts.
+// Falls back to PurchaseDatePST field if PurchaseDate is empty.
+func (i InApp) ParsePurchaseDateString() (time.Time, error) {
+	if i.PurchaseDate == nil || i.PurchaseDate.Raw == "" {
+		return i.PurchaseDatePST.parse()
+	}
+	return i.PurchaseDate.parse()
 }
 
 // Trial return true if subscription is in trial period
@@ -169,10 +302,15 @@ func (i InApp) Trial() bool {
 
 // Status return subscription status
 func (i InApp) Status() SubscriptionStatus {
+	return i.statusAt(timeNow())
+}
+
+// statusAt return subscription status at the given time.
+func (i InApp) statusAt(t time.Time) SubscriptionStatus {
 	switch {
 	case i.Canceled():
 		return Canceled
-	case i.Expired():
+	case i.expiredAt(t):
 		return Expired
 	case i.Pending():
 		return Pending
@@ -183,6 +321,16 @@ func (i InApp) Status() SubscriptionStatus {
 	}
 }
 
+// CountByStatus return the number of in-app purchases in each status computed by InApp.Status method.
+// Statuses without purchases are absent in the result.
+func (i InApps) CountByStatus() map[SubscriptionStatus]int {
+	counts := make(map[SubscriptionStatus]int)
+	for _, inapp := range i {
+		counts[inapp.Status()]++
+	}
+	return counts
+}
+
 // Pending return true if subscription is in pending
 func (i InApp) Pending() bool {
 	if i.IsInBillingRetryPeriod != "" {
@@ -196,6 +344,196 @@ func (i InApp) Pending() bool {
 	return false
 }
 
+// IsConsumable return true if in-app purchase looks like a consumable product.
+// The receipt doesn't carry the product type, so the guess is based on the absence of
+// subscription specific fields: expiration date and any of auto-renewable subscription fields.
+// Note that non-consumable products have the same shape, so it's up to the caller
+// to distinguish them by product id.
+func (i InApp) IsConsumable() bool {
+	return i.ExpiresDateMS == 0 && !i.IsAutoRenewable()
+}
+
+// Refunded return true if transaction was refunded by Apple customer support
+func (i InApp) Refunded() bool {
+	return i.CancellationDateMS > 0 || i.CancellationReason != ""
+}
+
+// IsAutoRenewable return true if in-app purchase has any of auto-renewable subscription fields:
+// web order line item id, auto renew status, auto renew product id or subscription group identifier,
+// or it was in a trial or an introductory offer period, which only auto-renewable subscriptions have.
+// These fields are authoritative, so the expiration date alone doesn't make the purchase auto-renewable.
+func (i InApp) IsAutoRenewable() bool {
+	return i.WebOrderLineItemID != "" || i.AutoRenewStatus != "" || i.AutoRenewProductId != "" ||
+		i.SubscriptionGroupIdentifier != "" || i.IsTrialPeriod || i.IsInIntroOfferPeriod
+}
+
+// IsNonRenewingSubscription return true if in-app purchase has expiration date,
+// but doesn't have any of auto-renewable subscription fields.
+func (i InApp) IsNonRenewingSubscription() bool {
+	return i.ExpiresDateMS > 0 && !i.IsAutoRenewable()
+}
+
+// ProductKind represent enumeration of product kinds, which could be inferred from the transaction.
+type ProductKind int
+
+const (
+	// ConsumableKind represent consumable or non-consumable product, which can't be distinguished
+	// without the product catalog.
+	ConsumableKind ProductKind = iota
+	// AutoRenewableKind represent auto-renewable subscription.
+	AutoRenewableKind
+	// NonRenewingKind represent non-renewing subscription.
+	NonRenewingKind
+)
+
+// String return string representation of concrete ProductKind type.
+func (k ProductKind) String() string {
+	kinds := [...]string{
+		"consumable",
+		"auto-renewable",
+		"non-renewing",
+	}
+	if k < 0 || int(k) >= len(kinds) {
+		return "unknown"
+	}
+	return kinds[k]
+}
+
+// ProductKind return the kind of the purchased product inferred from the transaction fields,
+// exactly one of IsAutoRenewable, IsNonRenewingSubscription and IsConsumable is true for it.
+// Auto-renewable subscription fields take precedence, the transaction with expiration date
+// and without them is a non-renewing subscription, and the transaction without both is a consumable.
+// Refunded transactions keep their kind.
+func (i InApp) ProductKind() ProductKind {
+	switch {
+	case i.IsAutoRenewable():
+		return AutoRenewableKind
+	case i.IsNonRenewingSubscription():
+		return NonRenewingKind
+	default:
+		return ConsumableKind
+	}
+}
+
+// QuantityInt return the number of items purchased as an integer.
+//
+// Apple omits the quantity of subscription transactions, a subscription period can't be bought
+// in bulk, so the absent quantity of a subscription means 1. The absent quantity of a consumable
+// is reported as an error instead of being guessed, because the number of granted items depends on it.
+// An explicit value, including "0", is returned as is.
+func (i InApp) QuantityInt() (int, error) {
+	if i.Quantity == "" {
+		if i.IsConsumable() {
+			return 0, fmt.Errorf("consumable transaction %q has no quantity", i.TransactionID)
+		}
+		return 1, nil
+	}
+	quantity, err := strconv.Atoi(i.Quantity)
+	if err != nil || quantity < 0 {
+		return 0, fmt.Errorf("transaction %q has malformed quantity %q", i.TransactionID, i.Quantity)
+	}
+	return quantity, nil
+}
+
+// NonRenewingSubscriptions return a new InApps array which contains only non-renewing subscriptions
+func (i InApps) NonRenewingSubscriptions() InApps {
+	return i.filter(InApp.IsNonRenewingSubscription)
+}
+
+// PromotionalOfferID return the identifier of the promotional offer applied to the transaction.
+// The second return value is false if the transaction was purchased without a promotional offer.
+func (i InApp) PromotionalOfferID() (string, bool) {
+	return i.PromotionalOfferIdentifier, i.PromotionalOfferIdentifier != ""
+}
+
+// HasPromotionalOffer return true if any of in-app purchases was made with the given promotional offer.
+// It's useful to verify that the offer, which was signed by your server, was actually applied.
+func (i InApps) HasPromotionalOffer(offerID string) bool {
+	if offerID == "" {
+		return false
+	}
+	for _, inapp := range i {
+		if id, ok := inapp.PromotionalOfferID(); ok && id == offerID {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteJSONL writes in-app purchases to the given writer as JSON lines (NDJSON), one object per line.
+// Unlike marshaling the whole array, it doesn't buffer the output, so it's suitable for large exports.
+// It stops on the first write error.
+func (i InApps) WriteJSONL(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for n := range i {
+		if err := enc.Encode(&i[n]); err != nil {
+			return fmt.Errorf("can't write in-app purchase %d: %v", n, err)
+		}
+	}
+	return nil
+}
+
+// WithinRefundWindow return true if the purchase was made less than the given window ago
+// and wasn't refunded yet.
+func (i InApp) WithinRefundWindow(window time.Duration) bool {
+	if i.Refunded() {
+		return false
+	}
+	return convertToTime(i.PurchaseDateMS).Add(window).After(timeNow())
+}
+
+// BillingAnchorDay return the day of month in UTC, on which the subscription renews, derived from
+// the original purchase date. Apple clamps the anchor to the length of the month, so a subscription
+// anchored on the 31st renews on the 30th in April and on the 28th or 29th in February.
+// Returns 0 if the original purchase date is absent.
+func (i InApp) BillingAnchorDay() int {
+	original := convertToTime(i.OriginalPurchaseDateMS)
+	if original.IsZero() {
+		return 0
+	}
+	return original.Day()
+}
+
+// RoundMode represent enumeration of rounding modes for DaysRemaining function.
+type RoundMode int
+
+const (
+	// Floor represent rounding mode, which counts only complete days.
+	Floor RoundMode = iota
+	// Ceil represent rounding mode, which counts an incomplete day as a day.
+	Ceil
+	// Round represent rounding mode, which rounds to the nearest day, half away from zero.
+	Round
+)
+
+// TimeUntilExpiry return the duration till the expiration date, which is negative for expired subscriptions.
+func (i InApp) TimeUntilExpiry() time.Duration {
+	return convertToTime(i.ExpiresDateMS).Sub(timeNow())
+}
+
+// DaysRemaining return the number of days till the expiration date rounded by the given mode.
+// Returns 0 for expired subscriptions, use DaysRemainingSigned to get the negative number of days instead.
+func (i InApp) DaysRemaining(mode RoundMode) int {
+	if days := i.DaysRemainingSigned(mode); days > 0 {
+		return days
+	}
+	return 0
+}
+
+// DaysRemainingSigned does the same as DaysRemaining, but returns the negative number of days
+// since the expiration date for expired subscriptions.
+func (i InApp) DaysRemainingSigned(mode RoundMode) int {
+	days := float64(i.TimeUntilExpiry()) / float64(24*time.Hour)
+	switch mode {
+	case Ceil:
+		return int(math.Ceil(days))
+	case Round:
+		return int(math.Round(days))
+	default:
+		return int(math.Floor(days))
+	}
+}
+
 // Canceled return true if subscription was canceled
 func (i InApp) Canceled() bool {
 	if i.AutoRenewStatus != "" {
@@ -214,3 +552,45 @@ func (i InApp) Canceled() bool {
 	}
 	return false
 }
+
+// Reactivated return true if auto-renew of the given product was turned off and then turned back on,
+// which is useful to attribute win-back campaigns. The renewal status of every transaction is inspected
+// in chronological order, transactions without the status are skipped.
+//
+// The history is available only if the receipt was validated with exclude-old-transactions set to false,
+// otherwise the latest receipt info contains only the latest transaction and the toggle can't be seen.
+func (i InApps) Reactivated(productID string) bool {
+	return reactivated(i.autoRenewHistory(productID))
+}
+
+// autoRenewHistory return the chronologically ordered non-empty auto-renew statuses of the given product.
+func (i InApps) autoRenewHistory(productID string) []string {
+	inapps := i.byProduct(productID)
+	sort.SliceStable(inapps, func(a, b int) bool {
+		return inapps[a].PurchaseDateMS < inapps[b].PurchaseDateMS
+	})
+
+	var history []string
+	for _, inapp := range inapps {
+		if inapp.AutoRenewStatus != "" {
+			history = append(history, inapp.AutoRenewStatus)
+		}
+	}
+	return history
+}
+
+// reactivated return true if the "0" status is followed by the "1" status in the given history.
+func reactivated(history []string) bool {
+	off := false
+	for _, status := range history {
+		switch status {
+		case "0":
+			off = true
+		case "1":
+			if off {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,550 @@
+package ios
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInApps_Merge(t *testing.T) {
+	type args struct {
+		stored InApps
+		fresh  InApps
+	}
+	type test struct {
+		args args
+		want []string
+	}
+
+	tests := map[string]test{
+		"Disjoint": {
+			args{
+				stored: InApps{{TransactionID: "1", PurchaseDateMS: 1527811200000}},
+				fresh:  InApps{{TransactionID: "2", PurchaseDateMS: 1530403200000}},
+			},
+			[]string{"2", "1"},
+		},
+		"Overlapping": {
+			args{
+				stored: InApps{
+					{TransactionID: "1", PurchaseDateMS: 1527811200000},
+					{TransactionID: "2", PurchaseDateMS: 1530403200000},
+				},
+				fresh: InApps{
+					{TransactionID: "2", PurchaseDateMS: 1530403200000},
+					{TransactionID: "3", PurchaseDateMS: 1532995200000},
+				},
+			},
+			[]string{"3", "2", "1"},
+		},
+		"Empty": {
+			args{},
+			[]string{},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := tc.args.stored.Merge(tc.args.fresh)
+			if len(got) != len(tc.want) {
+				t.Fatalf("InApps.Merge() = %v, want transactions %v", got, tc.want)
+			}
+			for n := range tc.want {
+				if got[n].TransactionID != tc.want[n] {
+					t.Errorf("InApps.Merge()[%d] = transaction %v, want %v", n, got[n].TransactionID, tc.want[n])
+				}
+			}
+		})
+	}
+
+	t.Run("ConflictKeepsNewer", func(t *testing.T) {
+		stored := InApps{{TransactionID: "1", PurchaseDateMS: 1527811200000, ExpiresDateMS: 1}}
+		fresh := InApps{{TransactionID: "1", PurchaseDateMS: 1527811200001, ExpiresDateMS: 2}}
+
+		got := stored.Merge(fresh)
+		if len(got) != 1 || got[0].ExpiresDateMS != 2 {
+			t.Errorf("InApps.Merge() = %v, want the newer transaction", got)
+		}
+		if stored[0].ExpiresDateMS != 1 {
+			t.Errorf("InApps.Merge() should not change the original array")
+		}
+	})
+}
+
+func TestInApp_Expired(t *testing.T) {
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	type test struct {
+		inapp InApp
+		want  bool
+	}
+
+	tests := map[string]test{
+		"Active":       {InApp{ExpiresDateMS: timeMS(now.Add(time.Hour))}, false},
+		"Expired":      {InApp{ExpiresDateMS: timeMS(now.Add(-time.Hour))}, true},
+		"NoExpiration": {InApp{ProductID: "lifetime", PurchaseDateMS: timeMS(now.Add(-time.Hour))}, false},
+		"Consumable":   {InApp{ProductID: "coins", Quantity: "5"}, false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.inapp.Expired(); got != tc.want {
+				t.Errorf("InApp.Expired() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInApp_Times(t *testing.T) {
+	purchase := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	inapp := InApp{
+		PurchaseDateMS:         timeMS(purchase),
+		OriginalPurchaseDateMS: timeMS(purchase.AddDate(0, -1, 0)),
+		ExpiresDateMS:          timeMS(purchase.AddDate(0, 1, 0)),
+	}
+
+	type test struct {
+		got  time.Time
+		want time.Time
+	}
+
+	tests := map[string]test{
+		"PurchaseTime":         {inapp.PurchaseTime(), purchase},
+		"OriginalPurchaseTime": {inapp.OriginalPurchaseTime(), purchase.AddDate(0, -1, 0)},
+		"ExpiresTime":          {inapp.ExpiresTime(), purchase.AddDate(0, 1, 0)},
+		"CancellationTime":     {inapp.CancellationTime(), time.Time{}},
+		"ConsumableExpires":    {InApp{Quantity: "1"}.ExpiresTime(), time.Time{}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if !tc.got.Equal(tc.want) || tc.got.Location() != time.UTC {
+				t.Errorf("InApp.%s() = %v, want %v in UTC", name, tc.got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInApp_ParsePurchaseDateString(t *testing.T) {
+	want := time.Date(2013, 8, 1, 7, 0, 0, 0, time.UTC)
+
+	type test struct {
+		inapp   InApp
+		wantErr bool
+	}
+
+	tests := map[string]test{
+		"GMT":       {InApp{PurchaseDate: &AppleTime{Raw: "2013-08-01 07:00:00 Etc/GMT"}}, false},
+		"PST":       {InApp{PurchaseDatePST: &AppleTime{Raw: "2013-08-01 00:00:00 America/Los_Angeles"}}, false},
+		"Malformed": {InApp{PurchaseDate: &AppleTime{Raw: "2013-08-01T07:00:00Z"}}, true},
+		"BadZone":   {InApp{PurchaseDate: &AppleTime{Raw: "2013-08-01 07:00:00 Nowhere/City"}}, true},
+		"Empty":     {InApp{}, true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := tc.inapp.ParsePurchaseDateString()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("InApp.ParsePurchaseDateString() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if !tc.wantErr && !got.Equal(want) {
+				t.Errorf("InApp.ParsePurchaseDateString() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestInApp_IsNonRenewingSubscription(t *testing.T) {
+	type test struct {
+		inapp             InApp
+		wantNonRenewing   bool
+		wantAutoRenewable bool
+		wantConsumable    bool
+	}
+
+	tests := map[string]test{
+		"NonRenewing": {
+			InApp{ProductID: "season.pass", PurchaseDateMS: 1527811200000, ExpiresDateMS: 1535760000000},
+			true, false, false,
+		},
+		"AutoRenewable": {
+			InApp{ProductID: "monthly", PurchaseDateMS: 1527811200000, ExpiresDateMS: 1530403200000, WebOrderLineItemID: "1000000039614547"},
+			false, true, false,
+		},
+		"Consumable": {
+			InApp{ProductID: "coins", PurchaseDateMS: 1527811200000, Quantity: "1"},
+			false, false, true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.inapp.IsNonRenewingSubscription(); got != tc.wantNonRenewing {
+				t.Errorf("InApp.IsNonRenewingSubscription() = %v, want %v", got, tc.wantNonRenewing)
+			}
+			if got := tc.inapp.IsAutoRenewable(); got != tc.wantAutoRenewable {
+				t.Errorf("InApp.IsAutoRenewable() = %v, want %v", got, tc.wantAutoRenewable)
+			}
+			if got := tc.inapp.IsConsumable(); got != tc.wantConsumable {
+				t.Errorf("InApp.IsConsumable() = %v, want %v", got, tc.wantConsumable)
+			}
+		})
+	}
+
+	t.Run("Filter", func(t *testing.T) {
+		inapps := InApps{tests["AutoRenewable"].inapp, tests["NonRenewing"].inapp, tests["Consumable"].inapp}
+		got := inapps.NonRenewingSubscriptions()
+		if len(got) != 1 || got[0].ProductID != "season.pass" {
+			t.Errorf("InApps.NonRenewingSubscriptions() = %v, want only season.pass", got)
+		}
+	})
+}
+
+func TestInApps_HasPromotionalOffer(t *testing.T) {
+	type args struct {
+		offerID string
+	}
+	type test struct {
+		inapps InApps
+		args   args
+		want   bool
+	}
+
+	withOffer := InApps{
+		{ProductID: "monthly", TransactionID: "1"},
+		{ProductID: "monthly", TransactionID: "2", PromotionalOfferIdentifier: "winback.50"},
+	}
+	withoutOffer := InApps{{ProductID: "monthly", TransactionID: "1"}}
+
+	tests := map[string]test{
+		"Matching":     {withOffer, args{offerID: "winback.50"}, true},
+		"OtherOffer":   {withOffer, args{offerID: "winback.30"}, false},
+		"WithoutOffer": {withoutOffer, args{offerID: "winback.50"}, false},
+		"EmptyOfferID": {withoutOffer, args{offerID: ""}, false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.inapps.HasPromotionalOffer(tc.args.offerID); got != tc.want {
+				t.Errorf("InApps.HasPromotionalOffer() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("PromotionalOfferID", func(t *testing.T) {
+		if id, ok := withOffer[1].PromotionalOfferID(); id != "winback.50" || !ok {
+			t.Errorf("InApp.PromotionalOfferID() = (%v, %v), want (winback.50, true)", id, ok)
+		}
+		if id, ok := withOffer[0].PromotionalOfferID(); id != "" || ok {
+			t.Errorf("InApp.PromotionalOfferID() = (%v, %v), want (, false)", id, ok)
+		}
+	})
+}
+
+func TestInApps_Reactivated(t *testing.T) {
+	type test struct {
+		inapps InApps
+		want   bool
+	}
+
+	tests := map[string]test{
+		"OffThenOn": {InApps{
+			{ProductID: "monthly", PurchaseDateMS: 1527811200000, AutoRenewStatus: "1"},
+			{ProductID: "monthly", PurchaseDateMS: 1530403200000, AutoRenewStatus: "0"},
+			{ProductID: "monthly", PurchaseDateMS: 1532995200000, AutoRenewStatus: "1"},
+		}, true},
+		"OffThenOnUnordered": {InApps{
+			{ProductID: "monthly", PurchaseDateMS: 1532995200000, AutoRenewStatus: "1"},
+			{ProductID: "monthly", PurchaseDateMS: 1527811200000, AutoRenewStatus: "0"},
+		}, true},
+		"NeverToggled": {InApps{
+			{ProductID: "monthly", PurchaseDateMS: 1527811200000, AutoRenewStatus: "1"},
+			{ProductID: "monthly", PurchaseDateMS: 1530403200000, AutoRenewStatus: "1"},
+		}, false},
+		"OnThenOff": {InApps{
+			{ProductID: "monthly", PurchaseDateMS: 1527811200000, AutoRenewStatus: "1"},
+			{ProductID: "monthly", PurchaseDateMS: 1530403200000, AutoRenewStatus: "0"},
+		}, false},
+		"OtherProduct": {InApps{
+			{ProductID: "yearly", PurchaseDateMS: 1527811200000, AutoRenewStatus: "0"},
+			{ProductID: "monthly", PurchaseDateMS: 1530403200000, AutoRenewStatus: "1"},
+		}, false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.inapps.Reactivated("monthly"); got != tc.want {
+				t.Errorf("InApps.Reactivated() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInApp_QuantityInt(t *testing.T) {
+	type test struct {
+		json    string
+		want    int
+		wantErr bool
+	}
+
+	tests := map[string]test{
+		"SubscriptionAbsent":  {`{"product_id":"monthly","expires_date_ms":"1530403200000"}`, 1, false},
+		"SubscriptionEmpty":   {`{"product_id":"monthly","expires_date_ms":"1530403200000","quantity":""}`, 1, false},
+		"SubscriptionOne":     {`{"product_id":"monthly","expires_date_ms":"1530403200000","quantity":"1"}`, 1, false},
+		"SubscriptionZero":    {`{"product_id":"monthly","expires_date_ms":"1530403200000","quantity":"0"}`, 0, false},
+		"ConsumableAbsent":    {`{"product_id":"coins"}`, 0, true},
+		"ConsumableEmpty":     {`{"product_id":"coins","quantity":""}`, 0, true},
+		"ConsumableOne":       {`{"product_id":"coins","quantity":"1"}`, 1, false},
+		"ConsumableZero":      {`{"product_id":"coins","quantity":"0"}`, 0, false},
+		"ConsumableMalformed": {`{"product_id":"coins","quantity":"five"}`, 0, true},
+		"ConsumableNegative":  {`{"product_id":"coins","quantity":"-1"}`, 0, true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var inapp InApp
+			if err := json.Unmarshal([]byte(tc.json), &inapp); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			got, err := inapp.QuantityInt()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("InApp.QuantityInt() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("InApp.QuantityInt() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+type failingWriter struct {
+	writes int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return 0, errors.New("disk is full")
+}
+
+func TestInApps_WriteJSONL(t *testing.T) {
+	inapps := InApps{
+		{ProductID: "monthly", TransactionID: "1", PurchaseDateMS: 1527811200000, ExpiresDateMS: 1530403200000},
+		{ProductID: "coins", TransactionID: "2", Quantity: "5", PurchaseDateMS: 1527811300000},
+		{ProductID: "yearly", TransactionID: "3", IsTrialPeriod: true},
+	}
+
+	var buf bytes.Buffer
+	if err := inapps.WriteJSONL(&buf); err != nil {
+		t.Fatalf("InApps.WriteJSONL() error = %v", err)
+	}
+
+	var got InApps
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var inapp InApp
+		if err := json.Unmarshal(scanner.Bytes(), &inapp); err != nil {
+			t.Fatalf("can't unmarshal line %q: %v", scanner.Text(), err)
+		}
+		got = append(got, inapp)
+	}
+	if !reflect.DeepEqual(got, inapps) {
+		t.Errorf("InApps.WriteJSONL() = %v, want %v", got, inapps)
+	}
+
+	t.Run("WriteError", func(t *testing.T) {
+		w := &failingWriter{}
+		if err := inapps.WriteJSONL(w); err == nil {
+			t.Errorf("InApps.WriteJSONL() error = nil, want write error")
+		}
+		if w.writes != 1 {
+			t.Errorf("InApps.WriteJSONL() made %d writes, want 1", w.writes)
+		}
+	})
+}
+
+func TestInApp_WithinRefundWindow(t *testing.T) {
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	window := 14 * 24 * time.Hour
+
+	type test struct {
+		inapp InApp
+		want  bool
+	}
+
+	tests := map[string]test{
+		"InWindow":        {InApp{PurchaseDateMS: timeMS(now.Add(-24 * time.Hour))}, true},
+		"OutOfWindow":     {InApp{PurchaseDateMS: timeMS(now.Add(-30 * 24 * time.Hour))}, false},
+		"AlreadyRefunded": {InApp{PurchaseDateMS: timeMS(now.Add(-24 * time.Hour)), CancellationDateMS: timeMS(now), CancellationReason: "0"}, false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.inapp.WithinRefundWindow(window); got != tc.want {
+				t.Errorf("InApp.WithinRefundWindow() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInApp_DaysRemaining(t *testing.T) {
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	day := 24 * time.Hour
+
+	type args struct {
+		mode RoundMode
+	}
+	type test struct {
+		expires    time.Duration
+		args       args
+		want       int
+		wantSigned int
+	}
+
+	tests := map[string]test{
+		"FloorFraction":  {2*day + 18*time.Hour, args{mode: Floor}, 2, 2},
+		"CeilFraction":   {2*day + 6*time.Hour, args{mode: Ceil}, 3, 3},
+		"RoundDown":      {2*day + 6*time.Hour, args{mode: Round}, 2, 2},
+		"RoundUp":        {2*day + 18*time.Hour, args{mode: Round}, 3, 3},
+		"CeilLastHours":  {time.Hour, args{mode: Ceil}, 1, 1},
+		"FloorLastHours": {time.Hour, args{mode: Floor}, 0, 0},
+		"ExpiredFloor":   {-day - time.Hour, args{mode: Floor}, 0, -2},
+		"ExpiredCeil":    {-day - time.Hour, args{mode: Ceil}, 0, -1},
+		"ExpiredRound":   {-day - 18*time.Hour, args{mode: Round}, 0, -2},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			inapp := InApp{ExpiresDateMS: timeMS(now.Add(tc.expires))}
+			if got := inapp.TimeUntilExpiry(); got != tc.expires {
+				t.Errorf("InApp.TimeUntilExpiry() = %v, want %v", got, tc.expires)
+			}
+			if got := inapp.DaysRemaining(tc.args.mode); got != tc.want {
+				t.Errorf("InApp.DaysRemaining() = %v, want %v", got, tc.want)
+			}
+			if got := inapp.DaysRemainingSigned(tc.args.mode); got != tc.wantSigned {
+				t.Errorf("InApp.DaysRemainingSigned() = %v, want %v", got, tc.wantSigned)
+			}
+		})
+	}
+}
+
+func TestInApps_CountByStatus(t *testing.T) {
+	future := timeMS(time.Now().Add(24 * time.Hour))
+	past := timeMS(time.Now().Add(-24 * time.Hour))
+
+	inapps := InApps{
+		{ExpiresDateMS: future, IsTrialPeriod: true},
+		{ExpiresDateMS: future},
+		{ExpiresDateMS: future},
+		{ExpiresDateMS: future},
+		{ExpiresDateMS: past},
+		{ExpiresDateMS: past},
+		{ExpiresDateMS: future, IsInBillingRetryPeriod: "1"},
+		{ExpiresDateMS: future, AutoRenewStatus: "0"},
+	}
+
+	want := map[SubscriptionStatus]int{Trial: 1, Paid: 3, Expired: 2, Pending: 1, Canceled: 1}
+	if got := inapps.CountByStatus(); !reflect.DeepEqual(got, want) {
+		t.Errorf("InApps.CountByStatus() = %v, want %v", got, want)
+	}
+
+	if got := (InApps{}).CountByStatus(); len(got) != 0 {
+		t.Errorf("InApps.CountByStatus() = %v, want empty map", got)
+	}
+}
+
+func TestInApp_BillingAnchorDay(t *testing.T) {
+	type test struct {
+		original time.Time
+		want     int
+	}
+
+	tests := map[string]test{
+		"First":     {time.Date(2020, 1, 1, 0, 30, 0, 0, time.UTC), 1},
+		"Fifteenth": {time.Date(2020, 2, 15, 12, 0, 0, 0, time.UTC), 15},
+		"MonthEnd":  {time.Date(2020, 1, 31, 23, 59, 0, 0, time.UTC), 31},
+		"LocalZone": {time.Date(2020, 3, 1, 1, 0, 0, 0, time.FixedZone("UTC+3", 3*60*60)), 29},
+		"Absent":    {time.Time{}, 0},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var inapp InApp
+			if !tc.original.IsZero() {
+				inapp.OriginalPurchaseDateMS = timeMS(tc.original)
+			}
+			if got := inapp.BillingAnchorDay(); got != tc.want {
+				t.Errorf("InApp.BillingAnchorDay() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInApp_ProductKind(t *testing.T) {
+	type args struct {
+		inapp string
+	}
+	type test struct {
+		args args
+		want ProductKind
+	}
+
+	tests := map[string]test{
+		"AutoRenewable": {
+			args{inapp: `{"quantity":"1","product_id":"com.example.monthly","transaction_id":"1000000700000002",` +
+				`"original_transaction_id":"1000000700000001","purchase_date_ms":"1593561600000","expires_date_ms":"1596240000000",` +
+				`"web_order_line_item_id":"1000000055000002","is_trial_period":"false","is_in_intro_offer_period":"false",` +
+				`"subscription_group_identifier":"20571491"}`},
+			AutoRenewableKind,
+		},
+		"AutoRenewableWithoutLineItem": {
+			args{inapp: `{"product_id":"com.example.monthly","purchase_date_ms":"1593561600000","expires_date_ms":"1596240000000",` +
+				`"is_trial_period":"true"}`},
+			AutoRenewableKind,
+		},
+		"NonRenewing": {
+			args{inapp: `{"quantity":"1","product_id":"com.example.season","transaction_id":"1000000700000003",` +
+				`"purchase_date_ms":"1593561600000","expires_date_ms":"1601510400000","is_trial_period":"false"}`},
+			NonRenewingKind,
+		},
+		"Consumable": {
+			args{inapp: `{"quantity":"10","product_id":"com.example.coins","transaction_id":"1000000700000004",` +
+				`"original_transaction_id":"1000000700000004","purchase_date_ms":"1593561600000","is_trial_period":"false"}`},
+			ConsumableKind,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var inapp InApp
+			if err := json.Unmarshal([]byte(tc.args.inapp), &inapp); err != nil {
+				t.Fatalf("can't unmarshal in-app purchase: %v", err)
+			}
+			if got := inapp.ProductKind(); got != tc.want {
+				t.Errorf("InApp.ProductKind() = %v, want %v", got, tc.want)
+			}
+
+			kinds := 0
+			for _, is := range []bool{inapp.IsAutoRenewable(), inapp.IsNonRenewingSubscription(), inapp.IsConsumable()} {
+				if is {
+					kinds++
+				}
+			}
+			if kinds != 1 {
+				t.Errorf("InApp matches %d kinds, want exactly 1", kinds)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// Package iostest provides utilities for testing the code, which handles iOS in-app purchases.
+package iostest
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/heartwilltell/goinapp/ios"
+)
+
+// defaultPeriod is the subscription period used for transactions without expiration date.
+const defaultPeriod = 30 * 24 * time.Hour
+
+// SimulateRenewal returns a plausible transaction of the next subscription period of the given one.
+// The renewal starts at the expiration date of the given transaction and lasts for the same period,
+// or for 30 days if the given transaction has no expiration date.
+// It gets a new transaction id and web order line item id, but keeps the original transaction id,
+// so renewals could be chained to generate synthetic subscription histories.
+// Trial, introductory offer and cancellation fields are cleared, since a renewal is a regular paid period.
+func SimulateRenewal(in ios.InApp) ios.InApp {
+	period := time.Duration(in.ExpiresDateMS-in.PurchaseDateMS) * time.Millisecond
+	if in.ExpiresDateMS == 0 || period <= 0 {
+		period = defaultPeriod
+	}
+
+	start := time.Unix(0, in.ExpiresDateMS*int64(time.Millisecond))
+	if in.ExpiresDateMS == 0 {
+		start = time.Unix(0, in.PurchaseDateMS*int64(time.Millisecond)).Add(period)
+	}
+	end := start.Add(period)
+
+	out := in
+	out.TransactionID = nextID(in.TransactionID)
+	if in.WebOrderLineItemID != "" {
+		out.WebOrderLineItemID = nextID(in.WebOrderLineItemID)
+	}
+	if out.OriginalTransactionID == "" {
+		out.OriginalTransactionID = in.TransactionID
+	}
+
+	out.PurchaseDateMS = toMS(start)
+	out.PurchaseDate, out.PurchaseDatePST = formatDate(start)
+	out.ExpiresDateMS = toMS(end)
+	out.ExpiresDate, out.ExpiresDatePST = formatDate(end)
+	out.ExpiresDateFormatted, out.ExpiresDateFormattedPST = out.ExpiresDate, out.ExpiresDatePST
+
+	out.IsTrialPeriod = false
+	out.IsInIntroOfferPeriod = false
+	out.ExpirationIntent = ""
+	out.IsInBillingRetryPeriod = ""
+	out.CancellationDate = nil
+	out.CancellationDateMS = 0
+	out.CancellationDatePST = nil
+	out.CancellationReason = ""
+	return out
+}
+
+// nextID returns the id which follows the given one. Apple ids are numeric,
+// so the number is incremented, otherwise a suffix is appended.
+func nextID(id string) string {
+	if n, err := strconv.ParseInt(id, 10, 64); err == nil {
+		return strconv.FormatInt(n+1, 10)
+	}
+	return id + "-renewal"
+}
+
+// toMS convert Go time.Time to unix timestamp in milliseconds.
+func toMS(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// formatDate returns the human-readable Apple representation of the given time
+// in GMT and in Pacific time. The Pacific one is nil if the time zone database is unavailable.
+func formatDate(t time.Time) (gmt, pst *ios.AppleTime) {
+	const layout = "2006-01-02 15:04:05"
+
+	gmt = &ios.AppleTime{Time: t.UTC(), Raw: t.UTC().Format(layout) + " Etc/GMT"}
+	if loc, err := time.LoadLocation("America/Los_Angeles"); err == nil {
+		pst = &ios.AppleTime{Time: t.In(loc), Raw: t.In(loc).Format(layout) + " America/Los_Angeles"}
+	}
+	return gmt, pst
+}
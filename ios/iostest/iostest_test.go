@@ -0,0 +1,79 @@
+package iostest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/heartwilltell/goinapp/ios"
+)
+
+func TestSimulateRenewal(t *testing.T) {
+	purchase := time.Date(2020, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	type test struct {
+		in         ios.InApp
+		wantPeriod time.Duration
+	}
+
+	tests := map[string]test{
+		"Monthly": {
+			ios.InApp{
+				ProductID:             "monthly",
+				TransactionID:         "1000000600000001",
+				OriginalTransactionID: "1000000600000001",
+				WebOrderLineItemID:    "1000000050000001",
+				PurchaseDateMS:        toMS(purchase),
+				ExpiresDateMS:         toMS(purchase.AddDate(0, 1, 0)),
+				IsTrialPeriod:         true,
+			},
+			31 * 24 * time.Hour,
+		},
+		"WithoutExpiration": {
+			ios.InApp{
+				ProductID:             "monthly",
+				TransactionID:         "tx",
+				OriginalTransactionID: "tx",
+				PurchaseDateMS:        toMS(purchase),
+			},
+			defaultPeriod,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := SimulateRenewal(tc.in)
+
+			if got.ExpiresDateMS <= tc.in.ExpiresDateMS {
+				t.Errorf("SimulateRenewal().ExpiresDateMS = %v, want later than %v", got.ExpiresDateMS, tc.in.ExpiresDateMS)
+			}
+			if period := time.Duration(got.ExpiresDateMS-got.PurchaseDateMS) * time.Millisecond; period != tc.wantPeriod {
+				t.Errorf("SimulateRenewal() period = %v, want %v", period, tc.wantPeriod)
+			}
+			if got.OriginalTransactionID != tc.in.OriginalTransactionID {
+				t.Errorf("SimulateRenewal().OriginalTransactionID = %v, want %v", got.OriginalTransactionID, tc.in.OriginalTransactionID)
+			}
+			if got.TransactionID == tc.in.TransactionID {
+				t.Errorf("SimulateRenewal().TransactionID = %v, want a new id", got.TransactionID)
+			}
+			if got.IsTrialPeriod {
+				t.Errorf("SimulateRenewal().IsTrialPeriod = true, want false")
+			}
+		})
+	}
+
+	t.Run("Chain", func(t *testing.T) {
+		first := tests["Monthly"].in
+		second := SimulateRenewal(first)
+		third := SimulateRenewal(second)
+
+		if third.PurchaseDateMS != second.ExpiresDateMS {
+			t.Errorf("SimulateRenewal().PurchaseDateMS = %v, want %v", third.PurchaseDateMS, second.ExpiresDateMS)
+		}
+		if third.TransactionID == second.TransactionID || third.TransactionID == first.TransactionID {
+			t.Errorf("SimulateRenewal().TransactionID = %v, want a unique id", third.TransactionID)
+		}
+		if latest := (ios.InApps{first, second, third}).LatestInApp(); latest.TransactionID != third.TransactionID {
+			t.Errorf("InApps.LatestInApp().TransactionID = %v, want %v", latest.TransactionID, third.TransactionID)
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package ios
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrMalformedJWS is returned when the signed payload isn't a JWS in compact serialization.
+var ErrMalformedJWS = errors.New("malformed JWS")
+
+// jwsHeader type represents the protected header of the JWS signed by the App Store.
+type jwsHeader struct {
+	Alg string `json:"alg"`
+	// X5C is the certificate chain, the leaf certificate goes first.
+	// Each certificate is base64 (not base64url) encoded DER.
+	X5C []string `json:"x5c"`
+}
+
+// parseJWS splits the JWS in compact serialization, which is the header, the payload and the signature
+// joined by dots, and returns the decoded header and payload. The signature isn't verified.
+func parseJWS(jws string) (jwsHeader, []byte, error) {
+	var header jwsHeader
+
+	parts := strings.Split(jws, ".")
+	if len(parts) != 3 {
+		return header, nil, fmt.Errorf("%w: expected 3 parts, got %d", ErrMalformedJWS, len(parts))
+	}
+
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return header, nil, fmt.Errorf("%w: can't decode header: %v", ErrMalformedJWS, err)
+	}
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return header, nil, fmt.Errorf("%w: can't unmarshal header: %v", ErrMalformedJWS, err)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return header, nil, fmt.Errorf("%w: can't decode payload: %v", ErrMalformedJWS, err)
+	}
+	return header, payload, nil
+}
+
+// decodeJWS decodes the payload of the JWS into v without verifying the signature.
+func decodeJWS(jws string, v interface{}) (jwsHeader, error) {
+	header, payload, err := parseJWS(jws)
+	if err != nil {
+		return header, err
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return header, fmt.Errorf("can't unmarshal JWS payload: %v", err)
+	}
+	return header, nil
+}
@@ -0,0 +1,141 @@
+package ios
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// NotificationType represents enumeration of App Store server notification types.
+type NotificationType string
+
+const (
+	// NotificationCancel indicates that Apple customer support canceled the subscription and refunded the customer.
+	NotificationCancel NotificationType = "CANCEL"
+	// NotificationDidChangeRenewalPref indicates that the customer changed the product the subscription renews to.
+	NotificationDidChangeRenewalPref NotificationType = "DID_CHANGE_RENEWAL_PREF"
+	// NotificationDidChangeRenewalStatus indicates a change in the subscription renewal status.
+	NotificationDidChangeRenewalStatus NotificationType = "DID_CHANGE_RENEWAL_STATUS"
+	// NotificationDidFailToRenew indicates a subscription that failed to renew due to a billing issue.
+	NotificationDidFailToRenew NotificationType = "DID_FAIL_TO_RENEW"
+	// NotificationDidRecover indicates a successful automatic renewal of an expired subscription that failed to renew in the past.
+	NotificationDidRecover NotificationType = "DID_RECOVER"
+	// NotificationDidRenew indicates that the subscription successfully auto-renewed for a new period.
+	NotificationDidRenew NotificationType = "DID_RENEW"
+	// NotificationExpired indicates that the subscription expired after the customer turned off auto-renew.
+	// Only App Store Server Notifications V2 send it, V1 notifications don't notify about the expiration.
+	NotificationExpired NotificationType = "EXPIRED"
+	// NotificationInitialBuy occurs at the user's initial purchase of the subscription.
+	NotificationInitialBuy NotificationType = "INITIAL_BUY"
+	// NotificationInteractiveRenewal indicates the customer renewed a subscription interactively after it lapsed.
+	NotificationInteractiveRenewal NotificationType = "INTERACTIVE_RENEWAL"
+	// NotificationPriceIncreaseConsent indicates that the customer should consent to a subscription price increase.
+	NotificationPriceIncreaseConsent NotificationType = "PRICE_INCREASE_CONSENT"
+	// NotificationRefund indicates that the App Store successfully refunded a transaction.
+	NotificationRefund NotificationType = "REFUND"
+	// NotificationRevoke indicates that a purchase made through Family Sharing is no longer available.
+	NotificationRevoke NotificationType = "REVOKE"
+)
+
+// Notification type represents the App Store server-to-server notification about subscription status changes.
+// See Apple docs:
+// https://developer.apple.com/documentation/appstoreservernotifications/responsebody
+type Notification struct {
+	// The type that describes the in-app purchase event for which the App Store sent the notification.
+	NotificationType NotificationType `json:"notification_type"`
+	// The same value as the shared secret you submit in the password field of the ValidationRequest.
+	Password string `json:"password"`
+	// The environment for which the receipt was generated.
+	// “Sandbox” - for sandbox environment, “PROD” - for production environment.
+	Environment string `json:"environment"`
+	// A string that contains the app bundle ID.
+	BID string `json:"bid,omitempty"`
+	// A string that contains the app bundle version.
+	BVRS string `json:"bvrs,omitempty"`
+	// An identifier that App Store Connect generates and the App Store uses to uniquely identify
+	// the auto-renewable subscription that the user's subscription renews.
+	AutoRenewAdamId string `json:"auto_renew_adam_id,omitempty"`
+	// The product identifier of the auto-renewable subscription that the user's subscription renews.
+	AutoRenewProductId string `json:"auto_renew_product_id,omitempty"`
+	// The current renewal status for an auto-renewable subscription product.
+	// Note that these values are different from those of the auto_renew_status in the receipt.
+	// “true” - subscription will renew, “false” - customer has turned off automatic renewal.
+	AutoRenewStatus string `json:"auto_renew_status,omitempty"`
+	// The time and date that the customer enabled or disabled automatic renewal.
+	AutoRenewStatusChangeDate    *AppleTime `json:"auto_renew_status_change_date,omitempty"`
+	AutoRenewStatusChangeDateMS  int64      `json:"auto_renew_status_change_date_ms,omitempty,string"`
+	AutoRenewStatusChangeDatePST *AppleTime `json:"auto_renew_status_change_date_pst,omitempty"`
+	// The reason a subscription expired. Has the same values as expiration_intent in the receipt.
+	ExpirationIntent string `json:"expiration_intent,omitempty"`
+	// An object that contains information about the most recent in-app purchase transactions for the app.
+	UnifiedReceipt UnifiedReceipt `json:"unified_receipt,omitempty"`
+}
+
+// UnifiedReceipt type represents the unified_receipt object of the Notification.
+// It has the same shape as the ValidationResponse.
+type UnifiedReceipt struct {
+	// The environment for which the receipt was generated.
+	Environment string `json:"environment,omitempty"`
+	// The latest Base64-encoded app receipt.
+	LatestReceipt string `json:"latest_receipt,omitempty"`
+	// An array that contains the latest 100 in-app purchase transactions of the decoded value in latest_receipt.
+	LatestReceiptInfo InApps `json:"latest_receipt_info,omitempty"`
+	// An array where each element contains the pending renewal information
+	// for each auto-renewable subscription identified in product_id.
+	PendingRenewalInfo PendingRenewalInfos `json:"pending_renewal_info,omitempty"`
+	// The status code, where 0 indicates that the notification is valid.
+	Status int `json:"status"`
+}
+
+var (
+	ErrWrongNotificationPassword = errors.New("notification password doesn't match the shared secret")
+	ErrUnknownNotificationEnv    = errors.New("notification has unknown environment")
+)
+
+// Env returns the AppleEnv of the notification.
+// Returns ErrUnknownNotificationEnv if the environment field has unexpected value.
+func (n Notification) Env() (AppleEnv, error) {
+	switch n.Environment {
+	case "PROD", "Production":
+		return Production, nil
+	case "Sandbox":
+		return Sandbox, nil
+	default:
+		return Production, ErrUnknownNotificationEnv
+	}
+}
+
+// ValidateConsistency checks that the notification was sent with the given shared secret
+// and for the given environment. Processing the production notification with sandbox
+// configuration (or vice versa) silently corrupts the subscription state, so the
+// mismatch is reported as an error.
+func (n Notification) ValidateConsistency(env AppleEnv, secret string) error {
+	if subtle.ConstantTimeCompare([]byte(n.Password), []byte(secret)) != 1 {
+		return ErrWrongNotificationPassword
+	}
+
+	notificationEnv, err := n.Env()
+	if err != nil {
+		return fmt.Errorf("%v: %q", err, n.Environment)
+	}
+	if notificationEnv != env {
+		return fmt.Errorf("notification environment %s doesn't match expected %s", notificationEnv, env)
+	}
+	return nil
+}
+
+// AutoRenewAdamIDInt returns the numeric App Store identifier of the subscription product, which the user's
+// subscription renews. It identifies the same product as AutoRenewProductId, but is assigned by App Store Connect,
+// so it stays the same if the product id is reused and matches the ids in App Store Connect reports.
+// Returns an error if the field is absent or isn't a number.
+func (n Notification) AutoRenewAdamIDInt() (int64, error) {
+	if n.AutoRenewAdamId == "" {
+		return 0, errors.New("notification has no auto_renew_adam_id")
+	}
+	id, err := strconv.ParseInt(n.AutoRenewAdamId, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("notification has malformed auto_renew_adam_id %q: %v", n.AutoRenewAdamId, err)
+	}
+	return id, nil
+}
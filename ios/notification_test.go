@@ -0,0 +1,79 @@
+package ios
+
+import (
+	"testing"
+)
+
+func TestNotification_ValidateConsistency(t *testing.T) {
+	type args struct {
+		env    AppleEnv
+		secret string
+	}
+	type test struct {
+		args         args
+		notification Notification
+		wantErr      bool
+	}
+
+	tests := map[string]test{
+		"Production": {
+			args{env: Production, secret: "secret"},
+			Notification{Environment: "PROD", Password: "secret"},
+			false,
+		},
+		"Sandbox": {
+			args{env: Sandbox, secret: "secret"},
+			Notification{Environment: "Sandbox", Password: "secret"},
+			false,
+		},
+		"ProductionWithSandboxExpectation": {
+			args{env: Sandbox, secret: "secret"},
+			Notification{Environment: "PROD", Password: "secret"},
+			true,
+		},
+		"WrongPassword": {
+			args{env: Production, secret: "secret"},
+			Notification{Environment: "PROD", Password: "other"},
+			true,
+		},
+		"UnknownEnvironment": {
+			args{env: Production, secret: "secret"},
+			Notification{Environment: "Staging", Password: "secret"},
+			true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := tc.notification.ValidateConsistency(tc.args.env, tc.args.secret); (err != nil) != tc.wantErr {
+				t.Errorf("Notification.ValidateConsistency() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestNotification_AutoRenewAdamIDInt(t *testing.T) {
+	type test struct {
+		notification Notification
+		want         int64
+		wantErr      bool
+	}
+
+	tests := map[string]test{
+		"Valid":     {Notification{AutoRenewAdamId: "1452354611", AutoRenewProductId: "monthly"}, 1452354611, false},
+		"Empty":     {Notification{}, 0, true},
+		"Malformed": {Notification{AutoRenewAdamId: "monthly"}, 0, true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := tc.notification.AutoRenewAdamIDInt()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Notification.AutoRenewAdamIDInt() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("Notification.AutoRenewAdamIDInt() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
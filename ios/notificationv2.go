@@ -0,0 +1,235 @@
+package ios
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// NotificationSubtype represents enumeration of App Store server notification V2 subtypes,
+// which give details about the event of the notification type.
+type NotificationSubtype string
+
+const (
+	// SubtypeBillingRecovery applies to DID_RENEW and indicates that the expired subscription,
+	// which failed to renew in the past, successfully renewed.
+	SubtypeBillingRecovery NotificationSubtype = "BILLING_RECOVERY"
+	// SubtypeVoluntary applies to EXPIRED and indicates that the subscription expired
+	// after the customer turned off auto-renew.
+	SubtypeVoluntary NotificationSubtype = "VOLUNTARY"
+	// SubtypeBillingRetry applies to EXPIRED and indicates that the subscription expired,
+	// because the billing retry period ended without a successful billing transaction.
+	SubtypeBillingRetry NotificationSubtype = "BILLING_RETRY"
+	// SubtypePriceIncrease applies to EXPIRED and indicates that the subscription expired,
+	// because the customer didn't consent to the price increase.
+	SubtypePriceIncrease NotificationSubtype = "PRICE_INCREASE"
+	// SubtypeProductNotForSale applies to EXPIRED and indicates that the subscription expired,
+	// because the product wasn't available for purchase at the time of renewal.
+	SubtypeProductNotForSale NotificationSubtype = "PRODUCT_NOT_FOR_SALE"
+)
+
+// NotificationV2 type represents the decoded payload of App Store Server Notifications V2.
+// See Apple docs:
+// https://developer.apple.com/documentation/appstoreservernotifications/responsebodyv2decodedpayload
+//
+// DecodeNotificationV2 doesn't verify the signatures, so the content can't be trusted
+// until SignedPayload is verified against the X5C certificate chain.
+type NotificationV2 struct {
+	// The type that describes the in-app purchase event for which the App Store sent the notification.
+	NotificationType NotificationType `json:"notificationType"`
+	// The details about the notification type. Empty if the notification type has no subtypes.
+	Subtype NotificationSubtype `json:"subtype,omitempty"`
+	// The unique identifier of the notification, which could be used to skip duplicates.
+	NotificationUUID string `json:"notificationUUID"`
+	// The version of the notification, "2.0".
+	Version string `json:"version"`
+	// The time the App Store signed the notification in milliseconds.
+	SignedDate int64 `json:"signedDate"`
+	// The object that contains the app metadata and the signed transaction and renewal information.
+	Data NotificationV2Data `json:"data"`
+
+	// SignedPayload is the JWS, which the notification was decoded from.
+	SignedPayload string `json:"-"`
+	// X5C is the certificate chain from the header of the signed payload, the leaf certificate goes first.
+	// Each certificate is base64 encoded DER.
+	X5C []string `json:"-"`
+}
+
+// NotificationV2Data type represents the data object of NotificationV2.
+type NotificationV2Data struct {
+	// The unique identifier of the app. Absent in the sandbox environment.
+	AppAppleID int64 `json:"appAppleId,omitempty"`
+	// The bundle identifier of the app.
+	BundleID string `json:"bundleId"`
+	// The version of the build that identifies an iteration of the bundle.
+	BundleVersion string `json:"bundleVersion"`
+	// The server environment, which the notification applies to, either "Sandbox" or "Production".
+	Environment string `json:"environment"`
+	// The transaction information signed by the App Store in JWS format.
+	SignedTransactionInfo string `json:"signedTransactionInfo,omitempty"`
+	// The subscription renewal information signed by the App Store in JWS format.
+	SignedRenewalInfo string `json:"signedRenewalInfo,omitempty"`
+
+	// TransactionInfo is the decoded SignedTransactionInfo, nil if it's absent.
+	TransactionInfo *JWSTransaction `json:"-"`
+	// RenewalInfo is the decoded SignedRenewalInfo, nil if it's absent.
+	RenewalInfo *JWSRenewalInfo `json:"-"`
+}
+
+// JWSTransaction type represents the decoded transaction information signed by the App Store.
+// Dates are in milliseconds.
+// See Apple docs:
+// https://developer.apple.com/documentation/appstoreservernotifications/jwstransactiondecodedpayload
+type JWSTransaction struct {
+	TransactionID               string `json:"transactionId"`
+	OriginalTransactionID       string `json:"originalTransactionId"`
+	WebOrderLineItemID          string `json:"webOrderLineItemId,omitempty"`
+	BundleID                    string `json:"bundleId"`
+	ProductID                   string `json:"productId"`
+	SubscriptionGroupIdentifier string `json:"subscriptionGroupIdentifier,omitempty"`
+	PurchaseDate                int64  `json:"purchaseDate"`
+	OriginalPurchaseDate        int64  `json:"originalPurchaseDate"`
+	ExpiresDate                 int64  `json:"expiresDate,omitempty"`
+	Quantity                    int    `json:"quantity"`
+	// The type of the in-app purchase, like "Auto-Renewable Subscription" or "Consumable".
+	Type string `json:"type"`
+	// Either "PURCHASED" or "FAMILY_SHARED".
+	InAppOwnershipType string `json:"inAppOwnershipType"`
+	SignedDate         int64  `json:"signedDate"`
+	// The reason of the refund or revocation, 0 - other reason, 1 - issue in the app. Nil if not revoked.
+	RevocationReason *int  `json:"revocationReason,omitempty"`
+	RevocationDate   int64 `json:"revocationDate,omitempty"`
+	// True if the customer upgraded to another subscription.
+	IsUpgraded bool `json:"isUpgraded,omitempty"`
+	// 1 - introductory offer, 2 - promotional offer, 3 - offer code.
+	OfferType       int    `json:"offerType,omitempty"`
+	OfferIdentifier string `json:"offerIdentifier,omitempty"`
+	// The server environment claim, either "Sandbox" or "Production".
+	RawEnvironment  string `json:"environment"`
+	AppAccountToken string `json:"appAccountToken,omitempty"`
+}
+
+// Environment returns the server environment of the transaction parsed from the environment claim
+// the same way as AppleEnv is unmarshaled. The absent claim is Production, the zero value of AppleEnv.
+// Other claims, like "Xcode" and "LocalTesting" of StoreKit testing, are Sandbox,
+// so a transaction, which isn't a real purchase, is never taken for a production one.
+func (t JWSTransaction) Environment() AppleEnv {
+	if t.RawEnvironment == "" {
+		return Production
+	}
+
+	var env AppleEnv
+	claim, err := json.Marshal(t.RawEnvironment)
+	if err != nil || env.UnmarshalJSON(claim) != nil {
+		return Sandbox
+	}
+	return env
+}
+
+// JWSRenewalInfo type represents the decoded subscription renewal information signed by the App Store.
+// Dates are in milliseconds.
+// See Apple docs:
+// https://developer.apple.com/documentation/appstoreservernotifications/jwsrenewalinfodecodedpayload
+type JWSRenewalInfo struct {
+	OriginalTransactionID string `json:"originalTransactionId"`
+	ProductID             string `json:"productId"`
+	// The product identifier of the product that renews at the next billing period.
+	AutoRenewProductID string `json:"autoRenewProductId"`
+	// 0 - automatic renewal is off, 1 - automatic renewal is on.
+	AutoRenewStatus int `json:"autoRenewStatus"`
+	// Has the same values as expiration_intent in the receipt.
+	ExpirationIntent       int   `json:"expirationIntent,omitempty"`
+	IsInBillingRetryPeriod bool  `json:"isInBillingRetryPeriod,omitempty"`
+	GracePeriodExpiresDate int64 `json:"gracePeriodExpiresDate,omitempty"`
+	// 0 - the customer hasn't responded to the price increase, 1 - the customer consented to it.
+	PriceIncreaseStatus *int   `json:"priceIncreaseStatus,omitempty"`
+	OfferType           int    `json:"offerType,omitempty"`
+	OfferIdentifier     string `json:"offerIdentifier,omitempty"`
+	SignedDate          int64  `json:"signedDate"`
+	// The server environment claim, either "Sandbox" or "Production".
+	RawEnvironment string `json:"environment"`
+}
+
+// RenewalInfo type represents the subscription renewal information of StoreKit 2 with typed fields.
+type RenewalInfo struct {
+	AutoRenew          bool
+	AutoRenewProductID string
+	ExpirationIntent   ExpirationIntent
+	InBillingRetry     bool
+	// GracePeriodExpires is zero if the subscription isn't in the billing grace period.
+	GracePeriodExpires time.Time
+	Offer              OfferType
+	PriceIncrease      PriceConsentStatus
+}
+
+// Parsed returns the renewal information with numeric codes and dates converted to typed values.
+// The codes have the same meaning as in the receipt, so ExpirationIntent and PriceConsentStatus are reused.
+// Absent fields are converted to zero values: false, zero time and the unknown enum members.
+func (r JWSRenewalInfo) Parsed() RenewalInfo {
+	info := RenewalInfo{
+		AutoRenew:          r.AutoRenewStatus == 1,
+		AutoRenewProductID: r.AutoRenewProductID,
+		ExpirationIntent:   parseExpirationIntent(strconv.Itoa(r.ExpirationIntent)),
+		InBillingRetry:     r.IsInBillingRetryPeriod,
+		GracePeriodExpires: convertToTime(r.GracePeriodExpiresDate),
+		Offer:              parseOfferType(r.OfferType),
+	}
+	if r.PriceIncreaseStatus != nil {
+		info.PriceIncrease = parsePriceConsentStatus(strconv.Itoa(*r.PriceIncreaseStatus))
+	}
+	return info
+}
+
+// RenewalInfo returns the typed renewal information of the notification.
+// False is returned if the notification has no signed renewal information.
+func (n *NotificationV2) RenewalInfo() (RenewalInfo, bool) {
+	if n.Data.RenewalInfo == nil {
+		return RenewalInfo{}, false
+	}
+	return n.Data.RenewalInfo.Parsed(), true
+}
+
+// DecodeNotificationV2 decodes the body of App Store Server Notifications V2 request,
+// which is the JSON object with signedPayload field, including the nested signed transaction
+// and renewal information.
+//
+// The signatures AREN'T verified: the payload is only base64url decoded. The returned notification
+// keeps the signed payload and the certificate chain of its header, so it could be verified separately
+// before the content is trusted.
+func DecodeNotificationV2(body []byte) (*NotificationV2, error) {
+	var request struct {
+		SignedPayload string `json:"signedPayload"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, fmt.Errorf("can't unmarshal notification: %v", err)
+	}
+	if request.SignedPayload == "" {
+		return nil, errors.New("notification has no signedPayload")
+	}
+
+	var notification NotificationV2
+	header, err := decodeJWS(request.SignedPayload, &notification)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode signedPayload: %w", err)
+	}
+	notification.SignedPayload = request.SignedPayload
+	notification.X5C = header.X5C
+
+	if signed := notification.Data.SignedTransactionInfo; signed != "" {
+		var transaction JWSTransaction
+		if _, err := decodeJWS(signed, &transaction); err != nil {
+			return nil, fmt.Errorf("can't decode signedTransactionInfo: %w", err)
+		}
+		notification.Data.TransactionInfo = &transaction
+	}
+	if signed := notification.Data.SignedRenewalInfo; signed != "" {
+		var renewal JWSRenewalInfo
+		if _, err := decodeJWS(signed, &renewal); err != nil {
+			return nil, fmt.Errorf("can't decode signedRenewalInfo: %w", err)
+		}
+		notification.Data.RenewalInfo = &renewal
+	}
+	return &notification, nil
+}
@@ -0,0 +1,275 @@
+package ios
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// unsignedJWS return the JWS in compact serialization with the given header and payload and a fake signature.
+func unsignedJWS(t *testing.T, header jwsHeader, payload interface{}) string {
+	t.Helper()
+	h, err := json.Marshal(header)
+	if err != nil {
+		t.Fatalf("can't marshal JWS header: %v", err)
+	}
+	p, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("can't marshal JWS payload: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(h) + "." +
+		base64.RawURLEncoding.EncodeToString(p) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte("signature"))
+}
+
+// notificationV2Body return the body of App Store Server Notifications V2 request with the given payload.
+func notificationV2Body(t *testing.T, payload interface{}) []byte {
+	t.Helper()
+	header := jwsHeader{Alg: "ES256", X5C: []string{"leaf", "intermediate", "root"}}
+	body, err := json.Marshal(map[string]string{"signedPayload": unsignedJWS(t, header, payload)})
+	if err != nil {
+		t.Fatalf("can't marshal notification body: %v", err)
+	}
+	return body
+}
+
+func TestDecodeNotificationV2(t *testing.T) {
+	header := jwsHeader{Alg: "ES256", X5C: []string{"leaf"}}
+	revocationReason := 1
+	transaction := JWSTransaction{
+		TransactionID:         "2",
+		OriginalTransactionID: "1",
+		ProductID:             "monthly",
+		PurchaseDate:          1527811200000,
+		ExpiresDate:           1530403200000,
+		Quantity:              1,
+		Type:                  "Auto-Renewable Subscription",
+		RawEnvironment:        "Sandbox",
+	}
+	refunded := transaction
+	refunded.RevocationReason = &revocationReason
+	refunded.RevocationDate = 1528811200000
+	renewal := JWSRenewalInfo{
+		OriginalTransactionID: "1",
+		ProductID:             "monthly",
+		AutoRenewProductID:    "monthly",
+		AutoRenewStatus:       0,
+		ExpirationIntent:      1,
+	}
+
+	type test struct {
+		payload         map[string]interface{}
+		wantType        NotificationType
+		wantSubtype     NotificationSubtype
+		wantTransaction *JWSTransaction
+		wantRenewal     *JWSRenewalInfo
+	}
+
+	tests := map[string]test{
+		"DidRenew": {
+			map[string]interface{}{
+				"notificationType": "DID_RENEW",
+				"subtype":          "BILLING_RECOVERY",
+				"notificationUUID": "uuid",
+				"data": map[string]interface{}{
+					"bundleId":              "com.example.app",
+					"environment":           "Sandbox",
+					"signedTransactionInfo": unsignedJWS(t, header, transaction),
+					"signedRenewalInfo":     unsignedJWS(t, header, renewal),
+				},
+			},
+			NotificationDidRenew, SubtypeBillingRecovery, &transaction, &renewal,
+		},
+		"Expired": {
+			map[string]interface{}{
+				"notificationType": "EXPIRED",
+				"subtype":          "VOLUNTARY",
+				"data": map[string]interface{}{
+					"signedRenewalInfo": unsignedJWS(t, header, renewal),
+				},
+			},
+			NotificationExpired, SubtypeVoluntary, nil, &renewal,
+		},
+		"Refund": {
+			map[string]interface{}{
+				"notificationType": "REFUND",
+				"data": map[string]interface{}{
+					"signedTransactionInfo": unsignedJWS(t, header, refunded),
+				},
+			},
+			NotificationRefund, "", &refunded, nil,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := DecodeNotificationV2(notificationV2Body(t, tc.payload))
+			if err != nil {
+				t.Fatalf("DecodeNotificationV2() error = %v", err)
+			}
+			if got.NotificationType != tc.wantType || got.Subtype != tc.wantSubtype {
+				t.Errorf("DecodeNotificationV2() = %v/%v, want %v/%v", got.NotificationType, got.Subtype, tc.wantType, tc.wantSubtype)
+			}
+			if len(got.X5C) != 3 || got.X5C[0] != "leaf" || got.SignedPayload == "" {
+				t.Errorf("DecodeNotificationV2() x5c = %v with signed payload %q, want the chain of the payload header", got.X5C, got.SignedPayload)
+			}
+
+			gotTransaction, _ := json.Marshal(got.Data.TransactionInfo)
+			wantTransaction, _ := json.Marshal(tc.wantTransaction)
+			if string(gotTransaction) != string(wantTransaction) {
+				t.Errorf("DecodeNotificationV2() transaction = %s, want %s", gotTransaction, wantTransaction)
+			}
+			gotRenewal, _ := json.Marshal(got.Data.RenewalInfo)
+			wantRenewal, _ := json.Marshal(tc.wantRenewal)
+			if string(gotRenewal) != string(wantRenewal) {
+				t.Errorf("DecodeNotificationV2() renewal = %s, want %s", gotRenewal, wantRenewal)
+			}
+		})
+	}
+}
+
+func TestDecodeNotificationV2_Errors(t *testing.T) {
+	type test struct {
+		body          []byte
+		wantMalformed bool
+	}
+
+	tests := map[string]test{
+		"NotJSON":          {[]byte("signedPayload"), false},
+		"NoSignedPayload":  {[]byte(`{"notificationType":"DID_RENEW"}`), false},
+		"TwoParts":         {[]byte(`{"signedPayload":"header.payload"}`), true},
+		"NotBase64Payload": {[]byte(`{"signedPayload":"e30.!!!.signature"}`), true},
+		"MalformedTransaction": {
+			notificationV2Body(t, map[string]interface{}{
+				"notificationType": "DID_RENEW",
+				"data":             map[string]string{"signedTransactionInfo": "transaction"},
+			}),
+			true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := DecodeNotificationV2(tc.body)
+			if err == nil {
+				t.Fatalf("DecodeNotificationV2() error = nil, want error")
+			}
+			if errors.Is(err, ErrMalformedJWS) != tc.wantMalformed {
+				t.Errorf("DecodeNotificationV2() error = %v, want ErrMalformedJWS %v", err, tc.wantMalformed)
+			}
+		})
+	}
+}
+
+func TestJWSTransaction_Environment(t *testing.T) {
+	type test struct {
+		payload string
+		want    AppleEnv
+	}
+
+	tests := map[string]test{
+		"Production":   {`{"transactionId":"1","environment":"Production"}`, Production},
+		"Sandbox":      {`{"transactionId":"1","environment":"Sandbox"}`, Sandbox},
+		"Missing":      {`{"transactionId":"1"}`, Production},
+		"Xcode":        {`{"transactionId":"1","environment":"Xcode"}`, Sandbox},
+		"LocalTesting": {`{"transactionId":"1","environment":"LocalTesting"}`, Sandbox},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var transaction JWSTransaction
+			if err := json.Unmarshal([]byte(tc.payload), &transaction); err != nil {
+				t.Fatalf("can't unmarshal transaction: %v", err)
+			}
+			if got := transaction.Environment(); got != tc.want {
+				t.Errorf("JWSTransaction.Environment() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNotificationV2_RenewalInfo(t *testing.T) {
+	header := jwsHeader{Alg: "ES256", X5C: []string{"leaf"}}
+	gracePeriodExpires := time.Date(2021, 6, 8, 0, 0, 0, 0, time.UTC)
+
+	type test struct {
+		renewal map[string]interface{}
+		want    RenewalInfo
+		wantOK  bool
+	}
+
+	tests := map[string]test{
+		"GracePeriod": {
+			map[string]interface{}{
+				"originalTransactionId":  "1",
+				"productId":              "monthly",
+				"autoRenewProductId":     "monthly",
+				"autoRenewStatus":        1,
+				"expirationIntent":       2,
+				"isInBillingRetryPeriod": true,
+				"gracePeriodExpiresDate": timeMS(gracePeriodExpires),
+				"offerType":              2,
+			},
+			RenewalInfo{
+				AutoRenew:          true,
+				AutoRenewProductID: "monthly",
+				ExpirationIntent:   ExpirationIntentBillingError,
+				InBillingRetry:     true,
+				GracePeriodExpires: gracePeriodExpires,
+				Offer:              OfferTypePromotional,
+			},
+			true,
+		},
+		"PriceIncrease": {
+			map[string]interface{}{
+				"originalTransactionId": "1",
+				"productId":             "monthly",
+				"autoRenewProductId":    "yearly",
+				"autoRenewStatus":       0,
+				"expirationIntent":      3,
+				"priceIncreaseStatus":   0,
+				"offerType":             1,
+			},
+			RenewalInfo{
+				AutoRenewProductID: "yearly",
+				ExpirationIntent:   ExpirationIntentPriceIncrease,
+				Offer:              OfferTypeIntroductory,
+				PriceIncrease:      PriceConsentPending,
+			},
+			true,
+		},
+		"PriceIncreaseAgreed": {
+			map[string]interface{}{"productId": "monthly", "autoRenewStatus": 1, "priceIncreaseStatus": 1},
+			RenewalInfo{AutoRenew: true, PriceIncrease: PriceConsentAgreed},
+			true,
+		},
+		"Absent": {nil, RenewalInfo{}, false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			data := map[string]interface{}{"bundleId": "com.example.app"}
+			if tc.renewal != nil {
+				data["signedRenewalInfo"] = unsignedJWS(t, header, tc.renewal)
+			}
+			notification, err := DecodeNotificationV2(notificationV2Body(t, map[string]interface{}{
+				"notificationType": "DID_FAIL_TO_RENEW",
+				"data":             data,
+			}))
+			if err != nil {
+				t.Fatalf("DecodeNotificationV2() error = %v", err)
+			}
+
+			got, ok := notification.RenewalInfo()
+			if ok != tc.wantOK || !got.GracePeriodExpires.Equal(tc.want.GracePeriodExpires) {
+				t.Fatalf("NotificationV2.RenewalInfo() = %+v, %v, want %+v, %v", got, ok, tc.want, tc.wantOK)
+			}
+			got.GracePeriodExpires, tc.want.GracePeriodExpires = time.Time{}, time.Time{}
+			if got != tc.want {
+				t.Errorf("NotificationV2.RenewalInfo() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
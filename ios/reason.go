@@ -0,0 +1,200 @@
+package ios
+
+// ExpirationIntent represents enumeration of reasons of subscription expiration.
+type ExpirationIntent int
+
+const (
+	// ExpirationIntentUnknown represents absent or unrecognized expiration intent.
+	ExpirationIntentUnknown ExpirationIntent = iota
+	// ExpirationIntentCanceled represents customer's subscription cancellation.
+	ExpirationIntentCanceled
+	// ExpirationIntentBillingError represents billing error, for example customer's payment information was no longer valid.
+	ExpirationIntentBillingError
+	// ExpirationIntentPriceIncrease represents customer's disagreement with a recent price increase.
+	ExpirationIntentPriceIncrease
+	// ExpirationIntentProductUnavailable represents product unavailability at the time of renewal.
+	ExpirationIntentProductUnavailable
+	// ExpirationIntentOther represents an unknown error reported by Apple.
+	ExpirationIntentOther
+)
+
+// String return string representation of concrete ExpirationIntent type.
+func (e ExpirationIntent) String() string {
+	intents := [...]string{
+		"unknown",
+		"customer canceled",
+		"billing error",
+		"price increase declined",
+		"product unavailable",
+		"other error",
+	}
+	if e < 0 || int(e) >= len(intents) {
+		return intents[ExpirationIntentUnknown]
+	}
+	return intents[e]
+}
+
+// parseExpirationIntent converts Apple expiration intent code to ExpirationIntent type.
+func parseExpirationIntent(code string) ExpirationIntent {
+	intents := map[string]ExpirationIntent{
+		"1": ExpirationIntentCanceled,
+		"2": ExpirationIntentBillingError,
+		"3": ExpirationIntentPriceIncrease,
+		"4": ExpirationIntentProductUnavailable,
+		"5": ExpirationIntentOther,
+	}
+	return intents[code]
+}
+
+// PriceConsentStatus represents enumeration of customer's consent statuses for a subscription price increase.
+type PriceConsentStatus int
+
+const (
+	// PriceConsentUnknown represents absent status, which means there is no price increase.
+	PriceConsentUnknown PriceConsentStatus = iota
+	// PriceConsentPending represents customer who hasn't taken action regarding the increased price.
+	PriceConsentPending
+	// PriceConsentAgreed represents customer who has agreed to the price increase.
+	PriceConsentAgreed
+)
+
+// String return string representation of concrete PriceConsentStatus type.
+func (p PriceConsentStatus) String() string {
+	statuses := [...]string{
+		"unknown",
+		"pending",
+		"agreed",
+	}
+	if p < 0 || int(p) >= len(statuses) {
+		return statuses[PriceConsentUnknown]
+	}
+	return statuses[p]
+}
+
+// parsePriceConsentStatus converts Apple price consent status code to PriceConsentStatus type.
+func parsePriceConsentStatus(code string) PriceConsentStatus {
+	statuses := map[string]PriceConsentStatus{
+		"0": PriceConsentPending,
+		"1": PriceConsentAgreed,
+	}
+	return statuses[code]
+}
+
+// OfferType represents enumeration of subscription offer types of StoreKit 2 transactions and renewals.
+type OfferType int
+
+const (
+	// OfferTypeNone represents absent or unrecognized offer type.
+	OfferTypeNone OfferType = iota
+	// OfferTypeIntroductory represents an introductory offer.
+	OfferTypeIntroductory
+	// OfferTypePromotional represents a promotional offer.
+	OfferTypePromotional
+	// OfferTypeOfferCode represents an offer with a subscription offer code.
+	OfferTypeOfferCode
+)
+
+// String return string representation of concrete OfferType type.
+func (o OfferType) String() string {
+	types := [...]string{
+		"none",
+		"introductory",
+		"promotional",
+		"offer code",
+	}
+	if o < 0 || int(o) >= len(types) {
+		return types[OfferTypeNone]
+	}
+	return types[o]
+}
+
+// parseOfferType converts Apple offer type code to OfferType type.
+func parseOfferType(code int) OfferType {
+	types := map[int]OfferType{
+		1: OfferTypeIntroductory,
+		2: OfferTypePromotional,
+		3: OfferTypeOfferCode,
+	}
+	return types[code]
+}
+
+// CancellationReason represents enumeration of reasons of the refund or cancellation by Apple support.
+type CancellationReason int
+
+const (
+	// CancellationReasonUnknown represents absent or unrecognized cancellation reason.
+	CancellationReasonUnknown CancellationReason = iota
+	// CancellationReasonOther represents cancellation for another reason, for example an accidental purchase.
+	CancellationReasonOther
+	// CancellationReasonAppIssue represents cancellation because of an actual or perceived issue within the app.
+	CancellationReasonAppIssue
+)
+
+// String return string representation of concrete CancellationReason type.
+func (c CancellationReason) String() string {
+	reasons := [...]string{
+		"unknown",
+		"other reason",
+		"app issue",
+	}
+	if c < 0 || int(c) >= len(reasons) {
+		return reasons[CancellationReasonUnknown]
+	}
+	return reasons[c]
+}
+
+// parseCancellationReason converts Apple cancellation reason code to CancellationReason type.
+func parseCancellationReason(code string) CancellationReason {
+	reasons := map[string]CancellationReason{
+		"0": CancellationReasonOther,
+		"1": CancellationReasonAppIssue,
+	}
+	return reasons[code]
+}
+
+// ExpirationIntentReason return the typed reason of the subscription expiration.
+// ExpirationIntentUnknown is returned if the subscription isn't expired or the code is unrecognized.
+func (i InApp) ExpirationIntentReason() ExpirationIntent {
+	return parseExpirationIntent(i.ExpirationIntent)
+}
+
+// CancellationReasonCode return the typed reason of the refund or cancellation by Apple support.
+// CancellationReasonUnknown is returned if the purchase wasn't canceled or the code is unrecognized.
+func (i InApp) CancellationReasonCode() CancellationReason {
+	return parseCancellationReason(i.CancellationReason)
+}
+
+// PriceConsent return the typed customer's consent status for the subscription price increase.
+func (i InApp) PriceConsent() PriceConsentStatus {
+	return parsePriceConsentStatus(i.PriceConsentStatus)
+}
+
+// AutoRenewEnabled return true if the subscription will renew at the end of the current period.
+// False is returned if auto-renew is turned off or the status is absent.
+func (i InApp) AutoRenewEnabled() bool {
+	return i.AutoRenewStatus == "1"
+}
+
+// InBillingRetry return true if the App Store is attempting to renew the expired subscription.
+func (i InApp) InBillingRetry() bool {
+	return i.IsInBillingRetryPeriod == "1"
+}
+
+// ParsedPendingRenewal type represents the pending renewal info with typed fields.
+type ParsedPendingRenewal struct {
+	AutoRenew        bool
+	InBillingRetry   bool
+	ExpirationIntent ExpirationIntent
+	PriceConsent     PriceConsentStatus
+}
+
+// Parsed returns the pending renewal info with string fields converted to typed values.
+// Absent fields are converted to zero values: false and the unknown enum members.
+func (p PendingRenewalInfo) Parsed() ParsedPendingRenewal {
+	return ParsedPendingRenewal{
+		AutoRenew:        p.SubscriptionAutoRenewStatus == "1",
+		InBillingRetry:   p.SubscriptionRetryFlag == "1",
+		ExpirationIntent: parseExpirationIntent(p.SubscriptionExpirationIntent),
+		PriceConsent:     parsePriceConsentStatus(p.SubscriptionPriceConsentStatus),
+	}
+}
@@ -0,0 +1,170 @@
+package ios
+
+import (
+	"testing"
+)
+
+func TestExpirationIntent_String(t *testing.T) {
+	type args struct {
+		code string
+	}
+	type test struct {
+		args args
+		want string
+	}
+
+	tests := map[string]test{
+		"Empty":              {args{code: ""}, "unknown"},
+		"Canceled":           {args{code: "1"}, "customer canceled"},
+		"BillingError":       {args{code: "2"}, "billing error"},
+		"PriceIncrease":      {args{code: "3"}, "price increase declined"},
+		"ProductUnavailable": {args{code: "4"}, "product unavailable"},
+		"Other":              {args{code: "5"}, "other error"},
+		"Unrecognized":       {args{code: "42"}, "unknown"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := parseExpirationIntent(tc.args.code).String(); got != tc.want {
+				t.Errorf("ExpirationIntent.String() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPriceConsentStatus_String(t *testing.T) {
+	type args struct {
+		code string
+	}
+	type test struct {
+		args args
+		want string
+	}
+
+	tests := map[string]test{
+		"Empty":   {args{code: ""}, "unknown"},
+		"Pending": {args{code: "0"}, "pending"},
+		"Agreed":  {args{code: "1"}, "agreed"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := parsePriceConsentStatus(tc.args.code).String(); got != tc.want {
+				t.Errorf("PriceConsentStatus.String() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOfferType_String(t *testing.T) {
+	type args struct {
+		code int
+	}
+	type test struct {
+		args args
+		want string
+	}
+
+	tests := map[string]test{
+		"Absent":       {args{code: 0}, "none"},
+		"Introductory": {args{code: 1}, "introductory"},
+		"Promotional":  {args{code: 2}, "promotional"},
+		"OfferCode":    {args{code: 3}, "offer code"},
+		"Unrecognized": {args{code: 42}, "none"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := parseOfferType(tc.args.code).String(); got != tc.want {
+				t.Errorf("OfferType.String() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCancellationReason_String(t *testing.T) {
+	type args struct {
+		code string
+	}
+	type test struct {
+		args args
+		want string
+	}
+
+	tests := map[string]test{
+		"Empty":        {args{code: ""}, "unknown"},
+		"Other":        {args{code: "0"}, "other reason"},
+		"AppIssue":     {args{code: "1"}, "app issue"},
+		"Unrecognized": {args{code: "7"}, "unknown"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := (InApp{CancellationReason: tc.args.code}).CancellationReasonCode().String(); got != tc.want {
+				t.Errorf("CancellationReason.String() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInApp_TypedReasons(t *testing.T) {
+	inapp := InApp{
+		ExpirationIntent:       "2",
+		CancellationReason:     "1",
+		PriceConsentStatus:     "0",
+		AutoRenewStatus:        "1",
+		IsInBillingRetryPeriod: "1",
+	}
+	if got := inapp.ExpirationIntentReason(); got != ExpirationIntentBillingError {
+		t.Errorf("InApp.ExpirationIntentReason() = %v, want %v", got, ExpirationIntentBillingError)
+	}
+	if got := inapp.CancellationReasonCode(); got != CancellationReasonAppIssue {
+		t.Errorf("InApp.CancellationReasonCode() = %v, want %v", got, CancellationReasonAppIssue)
+	}
+	if got := inapp.PriceConsent(); got != PriceConsentPending {
+		t.Errorf("InApp.PriceConsent() = %v, want %v", got, PriceConsentPending)
+	}
+	if !inapp.AutoRenewEnabled() || !inapp.InBillingRetry() {
+		t.Errorf("InApp.AutoRenewEnabled() = %v, InApp.InBillingRetry() = %v, want true", inapp.AutoRenewEnabled(), inapp.InBillingRetry())
+	}
+
+	var empty InApp
+	if empty.ExpirationIntentReason() != ExpirationIntentUnknown || empty.CancellationReasonCode() != CancellationReasonUnknown ||
+		empty.PriceConsent() != PriceConsentUnknown || empty.AutoRenewEnabled() || empty.InBillingRetry() {
+		t.Errorf("typed accessors of empty InApp should return unknown values and false")
+	}
+}
+
+func TestPendingRenewalInfo_Parsed(t *testing.T) {
+	type test struct {
+		info PendingRenewalInfo
+		want ParsedPendingRenewal
+	}
+
+	tests := map[string]test{
+		"FullyPopulated": {
+			PendingRenewalInfo{
+				ProductID:                      "monthly",
+				SubscriptionExpirationIntent:   "3",
+				SubscriptionRetryFlag:          "1",
+				SubscriptionAutoRenewStatus:    "1",
+				SubscriptionPriceConsentStatus: "0",
+			},
+			ParsedPendingRenewal{
+				AutoRenew:        true,
+				InBillingRetry:   true,
+				ExpirationIntent: ExpirationIntentPriceIncrease,
+				PriceConsent:     PriceConsentPending,
+			},
+		},
+		"Empty": {PendingRenewalInfo{}, ParsedPendingRenewal{}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.info.Parsed(); got != tc.want {
+				t.Errorf("PendingRenewalInfo.Parsed() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
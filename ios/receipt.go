@@ -1,5 +1,10 @@
 package ios
 
+import (
+	"strings"
+	"time"
+)
+
 // Receipt type has the receipt property
 type Receipt struct {
 	// The app’s bundle identifier.
@@ -26,25 +31,25 @@ type Receipt struct {
 	OriginalApplicationVersion string `json:"original_application_version,omitempty"`
 	// The date when the app receipt was created.
 	// When validating a receipt, use this date to validate the receipt’s signature.
-	ReceiptCreationDate    string `json:"receipt_creation_date,omitempty"`
-	ReceiptCreationDateMS  int64  `json:"receipt_creation_date_ms,string,omitempty"`
-	ReceiptCreationDatePST string `json:"receipt_creation_date_pst,omitempty"`
+	ReceiptCreationDate    *AppleTime `json:"receipt_creation_date,omitempty"`
+	ReceiptCreationDateMS  int64      `json:"receipt_creation_date_ms,string,omitempty"`
+	ReceiptCreationDatePST *AppleTime `json:"receipt_creation_date_pst,omitempty"`
 	// The date that the app receipt expires.
 	// This key is present only for apps purchased through the Volume Purchase Program.
 	// If this key is not present, the receipt does not expire.
 	// When validating a receipt, compare this date to the current date to determine whether the receipt is expired.
 	// Do not try to use this date to calculate any other information, such as the time remaining before expiration.
-	ReceiptExpirationDate    string `json:"receipt_expiration_date,omitempty"`
-	ReceiptExpirationDateMS  int64  `json:"receipt_expiration_date_ms,string,omitempty"`
-	ReceiptExpirationDatePST string `json:"receipt_expiration_date_pst,omitempty"`
+	ReceiptExpirationDate    *AppleTime `json:"receipt_expiration_date,omitempty"`
+	ReceiptExpirationDateMS  int64      `json:"receipt_expiration_date_ms,string,omitempty"`
+	ReceiptExpirationDatePST *AppleTime `json:"receipt_expiration_date_pst,omitempty"`
 	// OriginalPurchaseDate type indicates the beginning of the subscription period
-	OriginalPurchaseDate    string `json:"original_purchase_date,omitempty"`
-	OriginalPurchaseDateMS  int64  `json:"original_purchase_date_ms,string,omitempty"`
-	OriginalPurchaseDatePST string `json:"original_purchase_date_pst,omitempty"`
+	OriginalPurchaseDate    *AppleTime `json:"original_purchase_date,omitempty"`
+	OriginalPurchaseDateMS  int64      `json:"original_purchase_date_ms,string,omitempty"`
+	OriginalPurchaseDatePST *AppleTime `json:"original_purchase_date_pst,omitempty"`
 	// ReceiptRequestDate type indicates the date and time that the request was sent
-	ReceiptRequestDate    string `json:"request_date,omitempty"`
-	ReceiptRequestDateMS  int64  `json:"request_date_ms,string,omitempty"`
-	ReceiptRequestDatePST string `json:"request_date_pst,omitempty"`
+	ReceiptRequestDate    *AppleTime `json:"request_date,omitempty"`
+	ReceiptRequestDateMS  int64      `json:"request_date_ms,string,omitempty"`
+	ReceiptRequestDatePST *AppleTime `json:"request_date_pst,omitempty"`
 	// Undocumented field
 	AdamID int `json:"adam_id,omitempty"`
 	// Undocumented field
@@ -56,3 +61,61 @@ type Receipt struct {
 	// Undocumented field
 	ReceiptType string `json:"receipt_type,omitempty"`
 }
+
+// AppStoreIDs type bundles the undocumented App Store identifiers of the receipt,
+// which could be used to correlate the receipt with App Store Connect reports.
+// The zero value of any field means the identifier is absent in the receipt.
+type AppStoreIDs struct {
+	AdamID     int
+	AppItemID  int
+	DownloadID int
+}
+
+// HasAdamID return true if the receipt contains adam_id
+func (a AppStoreIDs) HasAdamID() bool {
+	return a.AdamID != 0
+}
+
+// HasAppItemID return true if the receipt contains app_item_id
+func (a AppStoreIDs) HasAppItemID() bool {
+	return a.AppItemID != 0
+}
+
+// HasDownloadID return true if the receipt contains download_id
+func (a AppStoreIDs) HasDownloadID() bool {
+	return a.DownloadID != 0
+}
+
+// AppStoreIDs return the undocumented App Store identifiers of the receipt
+func (r Receipt) AppStoreIDs() AppStoreIDs {
+	return AppStoreIDs{
+		AdamID:     r.AdamID,
+		AppItemID:  r.AppItemID,
+		DownloadID: r.DownloadID,
+	}
+}
+
+// FromTestEnvironment return true if the receipt looks like generated in the test environment.
+// It's a best-effort guess for the cases when the response environment is unavailable,
+// for example when only the receipt was stored. The undocumented receipt_type is trusted if present,
+// otherwise the receipt is considered a test one when it has neither app_item_id
+// nor version_external_identifier, which Apple doesn't assign in the test environment,
+// and the original application version is "1.0", which is always the case in the sandbox.
+func (r Receipt) FromTestEnvironment() bool {
+	if r.ReceiptType != "" {
+		return strings.HasSuffix(r.ReceiptType, "Sandbox")
+	}
+	return r.AppItemID == 0 && r.VersionExternalIdentifier == 0 && r.OriginalApplicationVersion == "1.0"
+}
+
+// CreationTime return the date when the receipt was created as time.Time in UTC
+// or zero time.Time if the date is absent.
+func (r Receipt) CreationTime() time.Time {
+	return convertToTime(r.ReceiptCreationDateMS)
+}
+
+// ExpirationTime return the date when the receipt expires as time.Time in UTC
+// or zero time.Time if the receipt doesn't expire. Only Volume Purchase Program receipts expire.
+func (r Receipt) ExpirationTime() time.Time {
+	return convertToTime(r.ReceiptExpirationDateMS)
+}
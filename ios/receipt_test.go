@@ -0,0 +1,105 @@
+package ios
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestReceipt_AppStoreIDs(t *testing.T) {
+	type args struct {
+		receipt string
+	}
+	type test struct {
+		args args
+		want AppStoreIDs
+		has  bool
+	}
+
+	tests := map[string]test{
+		"Populated": {
+			args{receipt: `{"bundle_id":"com.example.app","adam_id":284882215,"app_item_id":284882215,"download_id":80049365403548}`},
+			AppStoreIDs{AdamID: 284882215, AppItemID: 284882215, DownloadID: 80049365403548},
+			true,
+		},
+		"Absent": {
+			args{receipt: `{"bundle_id":"com.example.app"}`},
+			AppStoreIDs{},
+			false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var receipt Receipt
+			if err := json.Unmarshal([]byte(tc.args.receipt), &receipt); err != nil {
+				t.Fatalf("can't unmarshal receipt: %v", err)
+			}
+
+			got := receipt.AppStoreIDs()
+			if got != tc.want {
+				t.Errorf("Receipt.AppStoreIDs() = %+v, want %+v", got, tc.want)
+			}
+			if got.HasAdamID() != tc.has || got.HasAppItemID() != tc.has || got.HasDownloadID() != tc.has {
+				t.Errorf("AppStoreIDs.Has*() should return %v for %+v", tc.has, got)
+			}
+		})
+	}
+}
+
+func TestReceipt_FromTestEnvironment(t *testing.T) {
+	type args struct {
+		receipt string
+	}
+	type test struct {
+		args args
+		want bool
+	}
+
+	tests := map[string]test{
+		"SandboxShaped": {
+			args{receipt: `{"bundle_id":"com.example.app","application_version":"42","original_application_version":"1.0"}`},
+			true,
+		},
+		"ProductionShaped": {
+			args{receipt: `{"bundle_id":"com.example.app","app_item_id":284882215,"version_external_identifier":834289833,"original_application_version":"1.0"}`},
+			false,
+		},
+		"ProductionWithoutIDs": {
+			args{receipt: `{"bundle_id":"com.example.app","original_application_version":"37"}`},
+			false,
+		},
+		"SandboxReceiptType": {
+			args{receipt: `{"receipt_type":"ProductionSandbox","app_item_id":284882215,"original_application_version":"37"}`},
+			true,
+		},
+		"ProductionReceiptType": {
+			args{receipt: `{"receipt_type":"Production","original_application_version":"1.0"}`},
+			false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var receipt Receipt
+			if err := json.Unmarshal([]byte(tc.args.receipt), &receipt); err != nil {
+				t.Fatalf("can't unmarshal receipt: %v", err)
+			}
+			if got := receipt.FromTestEnvironment(); got != tc.want {
+				t.Errorf("Receipt.FromTestEnvironment() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReceipt_Times(t *testing.T) {
+	created := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	receipt := Receipt{ReceiptCreationDateMS: timeMS(created)}
+	if got := receipt.CreationTime(); !got.Equal(created) {
+		t.Errorf("Receipt.CreationTime() = %v, want %v", got, created)
+	}
+	if got := receipt.ExpirationTime(); !got.IsZero() {
+		t.Errorf("Receipt.ExpirationTime() = %v, want zero time", got)
+	}
+}
@@ -0,0 +1,129 @@
+package ios
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// ErrNotRecorded is returned by Validate in ReplayOnly mode of WithRecorder option,
+// when the interaction isn't recorded.
+var ErrNotRecorded = errors.New("interaction isn't recorded")
+
+// RecorderMode represents the way WithRecorder option handles interactions, which aren't recorded yet.
+type RecorderMode int
+
+const (
+	// RecordMissing sends the request, which isn't recorded, and records the interaction.
+	RecordMissing RecorderMode = iota
+	// ReplayOnly fails the request, which isn't recorded, with ErrNotRecorded without hitting the network.
+	ReplayOnly
+)
+
+// recording type represents the recorded interaction with the App Store,
+// which is stored as a JSON file by recorder.
+type recording struct {
+	URL        string      `json:"url"`
+	Request    string      `json:"request"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body"`
+}
+
+// recorder type implements http.RoundTripper, which replays the recorded interactions
+// and records the missing ones to the directory in RecordMissing mode.
+// Interactions are keyed by the endpoint and the receipt hash.
+type recorder struct {
+	dir  string
+	mode RecorderMode
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("recorder can't read request body: %v", err)
+		}
+		body = b
+	}
+
+	var payload ValidationRequest
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("recorder can't decode request body: %v", err)
+	}
+
+	sum := sha256.Sum256([]byte(req.URL.String() + "\n" + payload.ReceiptData))
+	path := filepath.Join(r.dir, hex.EncodeToString(sum[:])+".json")
+
+	if rec, err := ioutil.ReadFile(path); err == nil {
+		return r.replay(req, rec)
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("recorder can't read recording: %v", err)
+	}
+	if r.mode == ReplayOnly {
+		return nil, fmt.Errorf("%w: %s", ErrNotRecorded, req.URL)
+	}
+
+	outgoing := req.Clone(req.Context())
+	outgoing.Body = ioutil.NopCloser(bytes.NewReader(body))
+	res, err := r.next.RoundTrip(outgoing)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("recorder can't read response body: %v", err)
+	}
+
+	rec, err := json.MarshalIndent(recording{
+		URL:        req.URL.String(),
+		Request:    string(redactBytes(body, payload.ReceiptData, payload.Password)),
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+		Body:       string(redactBytes(resBody, "", payload.Password)),
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("recorder can't encode recording: %v", err)
+	}
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return nil, fmt.Errorf("recorder can't create directory: %v", err)
+	}
+	if err := ioutil.WriteFile(path, rec, 0644); err != nil {
+		return nil, fmt.Errorf("recorder can't write recording: %v", err)
+	}
+
+	res.Body = ioutil.NopCloser(bytes.NewReader(resBody))
+	return res, nil
+}
+
+// replay returns the response from the given recording.
+func (r *recorder) replay(req *http.Request, data []byte) (*http.Response, error) {
+	var rec recording
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("recorder can't decode recording: %v", err)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.StatusCode, http.StatusText(rec.StatusCode)),
+		StatusCode:    rec.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        rec.Header,
+		Body:          ioutil.NopCloser(bytes.NewReader([]byte(rec.Body))),
+		ContentLength: int64(len(rec.Body)),
+		Request:       req,
+	}, nil
+}
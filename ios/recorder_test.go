@@ -0,0 +1,117 @@
+package ios
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// offlineTransport type implements http.RoundTripper, which fails every request like a disabled network.
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("network is disabled")
+}
+
+func TestWithRecorder(t *testing.T) {
+	const password = "0123456789abcdef0123456789abcdef"
+
+	dir, err := ioutil.TempDir("", "recorder")
+	if err != nil {
+		t.Fatalf("can't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `{"status":0,"environment":"Sandbox","latest_receipt":"latest"}`)
+	}))
+	env := testEnv(server.URL)
+
+	v := NewValidator(WithPassword(password), WithRecorder(dir, RecordMissing))
+	recorded, err := v.Validate(context.Background(), "receipt", env)
+	if err != nil {
+		t.Fatalf("Validator.Validate() error = %v", err)
+	}
+	server.Close()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("recorder made %v recordings, want 1", len(files))
+	}
+	rec, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("can't read recording: %v", err)
+	}
+	if strings.Contains(string(rec), password) {
+		t.Errorf("recording %s contains the password", rec)
+	}
+
+	replayOpts := map[string][]ValidatorOption{
+		"Replay": {
+			WithPassword(password), WithHTTPClient(&http.Client{Transport: offlineTransport{}}), WithRecorder(dir, ReplayOnly),
+		},
+		"RecorderBeforeHTTPClient": {
+			WithPassword(password), WithRecorder(dir, ReplayOnly), WithHTTPClient(&http.Client{Transport: offlineTransport{}}),
+		},
+		"RecorderBeforeProxy": {
+			WithPassword(password), WithRecorder(dir, ReplayOnly), WithProxy("http://127.0.0.1:1"),
+		},
+		"RecordMissing": {
+			WithPassword(password), WithHTTPClient(&http.Client{Transport: offlineTransport{}}), WithRecorder(dir, RecordMissing),
+		},
+	}
+	for name, opts := range replayOpts {
+		t.Run(name, func(t *testing.T) {
+			v := NewValidator(opts...)
+			if err := v.Err(); err != nil {
+				t.Fatalf("Validator.Err() error = %v", err)
+			}
+			replayed, err := v.Validate(context.Background(), "receipt", env)
+			if err != nil {
+				t.Fatalf("Validator.Validate() error = %v", err)
+			}
+			if replayed.Status != recorded.Status || replayed.LatestReceipt != recorded.LatestReceipt || requests != 1 {
+				t.Errorf("Validator.Validate() = %+v after %v requests, want %+v after 1", replayed, requests, recorded)
+			}
+		})
+	}
+
+	t.Run("NotRecorded", func(t *testing.T) {
+		v := NewValidator(WithPassword(password), WithHTTPClient(&http.Client{Transport: offlineTransport{}}), WithRecorder(dir, RecordMissing))
+		_, err := v.Validate(context.Background(), "other", env)
+		if err == nil || errors.Is(err, ErrNotRecorded) {
+			t.Errorf("Validator.Validate() error = %v, want network error", err)
+		}
+	})
+
+	t.Run("NotRecordedReplayOnly", func(t *testing.T) {
+		v := NewValidator(WithPassword(password), WithRecorder(dir, ReplayOnly))
+		if _, err := v.Validate(context.Background(), "other", env); !errors.Is(err, ErrNotRecorded) {
+			t.Errorf("Validator.Validate() error = %v, want %v", err, ErrNotRecorded)
+		}
+		if files, _ := filepath.Glob(filepath.Join(dir, "*.json")); len(files) != 1 {
+			t.Errorf("recorder has %v recordings after replay only run, want 1", len(files))
+		}
+	})
+
+	t.Run("EmptyDir", func(t *testing.T) {
+		if err := NewValidator(WithRecorder("", RecordMissing)).Err(); err == nil {
+			t.Errorf("Validator.Err() = nil, want error")
+		}
+	})
+
+	t.Run("UnknownMode", func(t *testing.T) {
+		if err := NewValidator(WithRecorder(dir, RecorderMode(42))).Err(); err == nil {
+			t.Errorf("Validator.Err() = nil, want error")
+		}
+	})
+}
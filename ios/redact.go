@@ -0,0 +1,76 @@
+package ios
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// redactedSecret replaces the shared secret in errors and debug dumps.
+const redactedSecret = "[REDACTED]"
+
+// minRedactedLength is the minimum length of the receipt or the password, which is redacted.
+// Shorter values can't be real secrets, like App Store shared secrets of 32 characters, but could match
+// common text like "0" or "status", so replacing them would corrupt unrelated parts of messages and bodies.
+const minRedactedLength = 8
+
+// RedactReceipt returns the token, which identifies the receipt without revealing it,
+// so the receipt could be correlated in logs. The token is the prefix of receipt SHA-256 hash
+// like "receipt:sha256:1f2e3d4c5b6a". Empty receipt is returned as is.
+func RedactReceipt(receipt string) string {
+	if receipt == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(receipt))
+	return "receipt:sha256:" + hex.EncodeToString(sum[:6])
+}
+
+// redactedError represents the error with the receipt and the shared secret removed from the message.
+// The original error is still available by errors.Is and errors.As.
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactError returns the error with the receipt and the password removed from the message.
+// The error is returned unchanged if the message contains none of them.
+func redactError(err error, receipt, password string) error {
+	msg := err.Error()
+	redacted := redactString(msg, receipt, password)
+	if redacted == msg {
+		return err
+	}
+	return &redactedError{msg: redacted, err: err}
+}
+
+// redactString replaces the receipt with its token and the password with the placeholder.
+// Values shorter than minRedactedLength are left as is.
+func redactString(s, receipt, password string) string {
+	if len(receipt) >= minRedactedLength {
+		s = strings.Replace(s, receipt, RedactReceipt(receipt), -1)
+	}
+	if len(password) >= minRedactedLength {
+		s = strings.Replace(s, password, redactedSecret, -1)
+	}
+	return s
+}
+
+// redactBytes does the same as redactString, but for the raw response body.
+func redactBytes(b []byte, receipt, password string) []byte {
+	if len(receipt) >= minRedactedLength {
+		b = bytes.Replace(b, []byte(receipt), []byte(RedactReceipt(receipt)), -1)
+	}
+	if len(password) >= minRedactedLength {
+		b = bytes.Replace(b, []byte(password), []byte(redactedSecret), -1)
+	}
+	return b
+}
@@ -0,0 +1,130 @@
+package ios
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedactReceipt(t *testing.T) {
+	receipt := "MIIT0AYJKoZIhvcNAQcCoIITwTCCE70CAQExCzAJBgUrDgMCGgUAMIIDcQYJKoZIhvcNAQcBoIIDYgSCA14xggNaMAoCAQgCAQEEAhYAMAoCARQCAQEEAgwAMAsCAQECAQEEAwIBADALAgEDAgEBBAMMATEwCwIBCwIBAQQDAgEAMAsCAQ"
+
+	got := RedactReceipt(receipt)
+	if strings.Contains(got, receipt) || !strings.HasPrefix(got, "receipt:sha256:") {
+		t.Errorf("RedactReceipt() = %v, want hash-prefixed token", got)
+	}
+	if again := RedactReceipt(receipt); again != got {
+		t.Errorf("RedactReceipt() = %v, want stable token %v", again, got)
+	}
+	if other := RedactReceipt(receipt + "A"); other == got {
+		t.Errorf("RedactReceipt() returned the same token %v for different receipts", got)
+	}
+	if empty := RedactReceipt(""); empty != "" {
+		t.Errorf("RedactReceipt() = %v, want empty string", empty)
+	}
+}
+
+func TestValidator_Validate_Redaction(t *testing.T) {
+	const (
+		receipt  = "MIIT0AYJKoZIhvcNAQcCoIITwTCCE70CAQExCzAJBgUrDgMCGgUA"
+		password = "0123456789abcdef0123456789abcdef"
+	)
+
+	// The server echoes the request, like misbehaving proxies do,
+	// so both the error and the captured body contain the receipt and the password.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	errEcho := errors.New("echo")
+	decoder := func(r io.Reader, v interface{}) error {
+		body, _ := ioutil.ReadAll(r)
+		return fmt.Errorf("%w: unexpected response %s", errEcho, body)
+	}
+
+	v := NewValidator(WithPassword(password), WithDecoder(decoder), WithDebugCapture(1))
+	_, err := v.Validate(context.Background(), receipt, testEnv(server.URL))
+	if err == nil {
+		t.Fatalf("Validator.Validate() error = nil, want decoding error")
+	}
+
+	if msg := err.Error(); strings.Contains(msg, receipt) || strings.Contains(msg, password) {
+		t.Errorf("Validator.Validate() error = %v, want neither receipt nor password", msg)
+	}
+	if !strings.Contains(err.Error(), RedactReceipt(receipt)) {
+		t.Errorf("Validator.Validate() error = %v, want receipt token %v", err, RedactReceipt(receipt))
+	}
+	if !errors.Is(err, errEcho) {
+		t.Errorf("Validator.Validate() error = %v, want to wrap %v", err, errEcho)
+	}
+
+	for _, body := range v.LastResponses() {
+		if s := string(body); strings.Contains(s, receipt) || strings.Contains(s, password) {
+			t.Errorf("Validator.LastResponses() = %s, want neither receipt nor password", s)
+		}
+	}
+}
+
+func TestRedactString_Short(t *testing.T) {
+	type args struct {
+		s        string
+		receipt  string
+		password string
+	}
+	type test struct {
+		args args
+		want string
+	}
+
+	tests := map[string]test{
+		"ShortPassword": {args{`{"status":0}`, "", "0"}, `{"status":0}`},
+		"CommonWord":    {args{"unknown App Store status 21012", "", "status"}, "unknown App Store status 21012"},
+		"ShortReceipt":  {args{"receipt validation failed", "receipt", ""}, "receipt validation failed"},
+		"Secret": {
+			args{"password 0123456789abcdef0123456789abcdef", "", "0123456789abcdef0123456789abcdef"},
+			"password " + redactedSecret,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := redactString(tc.args.s, tc.args.receipt, tc.args.password); got != tc.want {
+				t.Errorf("redactString() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidator_Validate_RedactedHTTPStatusError(t *testing.T) {
+	const password = "0123456789abcdef0123456789abcdef"
+	receipt := strings.Repeat("MIIT0AYJKoZIhvcNAQcCoIITwTCCE70CAQExCzAJBgUrDgMCGgUA", 4)
+
+	// The failing server echoes the request after a long prefix,
+	// so the receipt crosses the end of the kept body snippet.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "%s%s", strings.Repeat(" ", maxErrorBodySnippet-100), body)
+	}))
+	defer server.Close()
+
+	_, err := NewValidator(WithPassword(password)).Validate(context.Background(), receipt, testEnv(server.URL))
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("Validator.Validate() error = %v, want *HTTPStatusError", err)
+	}
+	if strings.Contains(statusErr.Body, receipt[:50]) || strings.Contains(statusErr.Body, password) {
+		t.Errorf("HTTPStatusError.Body = %q, want neither receipt nor password", statusErr.Body)
+	}
+	if !strings.Contains(statusErr.Body, "receipt:sha256:") {
+		t.Errorf("HTTPStatusError.Body = %q, want receipt token", statusErr.Body)
+	}
+}
@@ -0,0 +1,110 @@
+package ios
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnexpectedHTTPStatus is matched by HTTPStatusError with errors.Is.
+var ErrUnexpectedHTTPStatus = errors.New("unexpected http status")
+
+// maxErrorBodySnippet is the maximum length of the response body kept in HTTPStatusError.
+const maxErrorBodySnippet = 512
+
+// HTTPStatusError is returned by Validate when the endpoint responds with non-2xx http status code,
+// which happens during App Store maintenance, when the response body is an HTML error page.
+// The body is never decoded in this case, so the error page can't be taken for a valid response.
+type HTTPStatusError struct {
+	StatusCode int
+	// RetryAfter is the delay requested by the Retry-After header, zero when the header is absent.
+	RetryAfter time.Duration
+	// Body is the beginning of the response body, up to 512 bytes,
+	// with the submitted receipt and the password redacted.
+	Body string
+}
+
+func (e *HTTPStatusError) Error() string {
+	msg := fmt.Sprintf("%v: %d %s", ErrUnexpectedHTTPStatus, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Body != "" {
+		msg += fmt.Sprintf(": %q", e.Body)
+	}
+	return msg
+}
+
+// Is makes HTTPStatusError match ErrUnexpectedHTTPStatus with errors.Is.
+func (e *HTTPStatusError) Is(target error) bool {
+	return target == ErrUnexpectedHTTPStatus
+}
+
+// Temporary returns true if the request could succeed later: the endpoint is rate limiting (429)
+// or has a server error (5xx). Client errors (4xx) are permanent.
+func (e *HTTPStatusError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+// newHTTPStatusError returns HTTPStatusError for the response with the beginning of its body.
+// The receipt and the password echoed in the body are redacted before the body is cut,
+// so a part of them can't be left at the end of the snippet.
+func newHTTPStatusError(res *http.Response, receipt, password string) *HTTPStatusError {
+	limit := int64(maxErrorBodySnippet + len(receipt) + len(password))
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, limit))
+	snippet := redactBytes(body, receipt, password)
+	if len(snippet) > maxErrorBodySnippet {
+		snippet = snippet[:maxErrorBodySnippet]
+	}
+	return &HTTPStatusError{
+		StatusCode: res.StatusCode,
+		RetryAfter: parseRetryAfter(res.Header.Get("Retry-After"), timeNow()),
+		Body:       strings.TrimSpace(string(snippet)),
+	}
+}
+
+// parseRetryAfter parses the value of Retry-After header, which is either
+// the number of seconds or the HTTP date. Returns zero for absent or malformed values.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// wait blocks for the given duration or until the context is done.
+// If the context deadline comes before the wait is over, context.DeadlineExceeded is returned
+// without waiting, because the next attempt would be canceled anyway.
+func (v *Validator) wait(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return context.DeadlineExceeded
+	}
+	if v.sleep != nil {
+		return v.sleep(ctx, d)
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,316 @@
+package ios
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	type args struct {
+		value string
+	}
+	type test struct {
+		args args
+		want time.Duration
+	}
+
+	tests := map[string]test{
+		"Empty":     {args{value: ""}, 0},
+		"Seconds":   {args{value: "2"}, 2 * time.Second},
+		"Negative":  {args{value: "-2"}, 0},
+		"Date":      {args{value: "Sat, 01 Jun 2019 12:00:30 GMT"}, 30 * time.Second},
+		"PastDate":  {args{value: "Sat, 01 Jun 2019 11:00:00 GMT"}, 0},
+		"Malformed": {args{value: "soon"}, 0},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := parseRetryAfter(tc.args.value, now); got != tc.want {
+				t.Errorf("parseRetryAfter() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidator_ValidateWithRetry_RetryAfter(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"status":0}`)
+	}))
+	defer server.Close()
+
+	var waited time.Duration
+	v := NewValidator(WithMaxRetries(1))
+	v.sleep = func(ctx context.Context, d time.Duration) error {
+		waited += d
+		return nil
+	}
+
+	resp, err := v.ValidateWithRetry(context.Background(), "receipt", testEnv(server.URL))
+	if err != nil {
+		t.Fatalf("Validator.ValidateWithRetry() error = %v", err)
+	}
+	if resp.Status != 0 || requests != 2 {
+		t.Errorf("Validator.ValidateWithRetry() status = %v after %v requests, want 0 after 2", resp.Status, requests)
+	}
+	if waited < 2*time.Second {
+		t.Errorf("Validator.ValidateWithRetry() waited %v, want at least %v", waited, 2*time.Second)
+	}
+}
+
+func TestValidator_Validate_TooManyRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	_, err := NewValidator().Validate(context.Background(), "receipt", testEnv(server.URL))
+	statusErr, ok := err.(*HTTPStatusError)
+	if !ok {
+		t.Fatalf("Validator.Validate() error = %v, want *HTTPStatusError", err)
+	}
+	if statusErr.StatusCode != http.StatusTooManyRequests || statusErr.RetryAfter != 5*time.Second {
+		t.Errorf("Validator.Validate() error = %+v, want 429 with 5s delay", statusErr)
+	}
+}
+
+func TestValidator_ValidateWithRetry_Deadline(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := NewValidator(WithMaxRetries(5)).ValidateWithRetry(ctx, "receipt", testEnv(server.URL))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Validator.ValidateWithRetry() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Validator.ValidateWithRetry() returned after %v, want before the deadline", elapsed)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("Validator.ValidateWithRetry() sent %v requests, want 1", n)
+	}
+}
+
+func TestValidator_Validate_UnexpectedHTTPStatus(t *testing.T) {
+	type args struct {
+		status int
+		body   string
+	}
+	type test struct {
+		args          args
+		wantBody      string
+		wantTemporary bool
+	}
+
+	tests := map[string]test{
+		"Maintenance":    {args{http.StatusInternalServerError, "<html>maintenance</html>"}, "<html>maintenance</html>", true},
+		"BadGateway":     {args{http.StatusBadGateway, `{"status":0}`}, `{"status":0}`, true},
+		"NotFound":       {args{http.StatusNotFound, "not found\n"}, "not found", false},
+		"LongBody":       {args{http.StatusInternalServerError, strings.Repeat("x", 1000)}, strings.Repeat("x", 512), true},
+		"EmptyBody":      {args{http.StatusForbidden, ""}, "", false},
+		"TooManyRequest": {args{http.StatusTooManyRequests, ""}, "", true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				w.WriteHeader(tc.args.status)
+				fmt.Fprint(w, tc.args.body)
+			}))
+			defer server.Close()
+
+			resp, err := NewValidator().Validate(context.Background(), "receipt", testEnv(server.URL))
+			if resp != nil || !errors.Is(err, ErrUnexpectedHTTPStatus) {
+				t.Fatalf("Validator.Validate() = %v, %v, want %v", resp, err, ErrUnexpectedHTTPStatus)
+			}
+			var statusErr *HTTPStatusError
+			if !errors.As(err, &statusErr) {
+				t.Fatalf("Validator.Validate() error = %v, want *HTTPStatusError", err)
+			}
+			if statusErr.StatusCode != tc.args.status || statusErr.Body != tc.wantBody || statusErr.Temporary() != tc.wantTemporary {
+				t.Errorf("Validator.Validate() error = %+v, want status %v with body %q and temporary %v",
+					statusErr, tc.args.status, tc.wantBody, tc.wantTemporary)
+			}
+
+			if tc.wantTemporary {
+				return
+			}
+			atomic.StoreInt32(&requests, 0)
+			if _, err := NewValidator(WithMaxRetries(2)).ValidateWithRetry(context.Background(), "receipt", testEnv(server.URL)); err == nil {
+				t.Fatalf("Validator.ValidateWithRetry() error = nil, want %v", ErrUnexpectedHTTPStatus)
+			}
+			if n := atomic.LoadInt32(&requests); n != 1 {
+				t.Errorf("Validator.ValidateWithRetry() sent %v requests, want 1 for permanent error", n)
+			}
+		})
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	type args struct {
+		maxAttempts int
+		responses   []string
+	}
+	type test struct {
+		args         args
+		wantStatus   int
+		wantRequests int
+	}
+
+	tests := map[string]test{
+		"InternalDataAccess": {args{3, []string{`{"status":21009}`, `{"status":0}`}}, 0, 2},
+		"ServerNotAvailable": {args{3, []string{`{"status":21005}`, `{"status":0}`}}, 0, 2},
+		"RetryableFlag":      {args{3, []string{`{"status":21199,"is-retryable":"true"}`, `{"status":0}`}}, 0, 2},
+		"IncorrectSecret":    {args{3, []string{`{"status":21004}`, `{"status":0}`}}, 21004, 1},
+		"Valid":              {args{3, []string{`{"status":0}`}}, 0, 1},
+		"Exhausted":          {args{3, []string{`{"status":21005}`, `{"status":21005}`, `{"status":21005}`, `{"status":0}`}}, 21005, 3},
+		"SingleAttempt":      {args{1, []string{`{"status":21005}`, `{"status":0}`}}, 21005, 1},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var requests int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, tc.args.responses[requests])
+				requests++
+			}))
+			defer server.Close()
+
+			var attempts []int
+			var waited time.Duration
+			backoff := func(attempt int) time.Duration {
+				attempts = append(attempts, attempt)
+				return time.Duration(attempt) * time.Second
+			}
+			v := NewValidator(WithRetry(tc.args.maxAttempts, backoff))
+			v.sleep = func(ctx context.Context, d time.Duration) error {
+				waited += d
+				return nil
+			}
+
+			resp, err := v.ValidateWithRetry(context.Background(), "receipt", testEnv(server.URL))
+			if err != nil {
+				t.Fatalf("Validator.ValidateWithRetry() error = %v", err)
+			}
+			if resp.Status != tc.wantStatus || requests != tc.wantRequests {
+				t.Errorf("Validator.ValidateWithRetry() status = %v after %v requests, want %v after %v",
+					resp.Status, requests, tc.wantStatus, tc.wantRequests)
+			}
+
+			// The backoff is called before each retry with the retry number starting from 1.
+			var wantWaited time.Duration
+			for n := 1; n < tc.wantRequests; n++ {
+				wantWaited += time.Duration(n) * time.Second
+			}
+			if len(attempts) != tc.wantRequests-1 || waited != wantWaited {
+				t.Errorf("Validator.ValidateWithRetry() backoff attempts = %v waited %v, want %v retries waiting %v",
+					attempts, waited, tc.wantRequests-1, wantWaited)
+			}
+		})
+	}
+
+	t.Run("InvalidAttempts", func(t *testing.T) {
+		if err := NewValidator(WithRetry(0, nil)).Err(); err == nil {
+			t.Errorf("Validator.Err() = nil, want error for 0 attempts")
+		}
+	})
+}
+
+func TestWithRetry_Canceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":21005}`)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	backoff := func(attempt int) time.Duration {
+		cancel()
+		return time.Minute
+	}
+
+	start := time.Now()
+	_, err := NewValidator(WithRetry(5, backoff)).ValidateWithRetry(ctx, "receipt", testEnv(server.URL))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Validator.ValidateWithRetry() error = %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Validator.ValidateWithRetry() returned after %v, want right after cancellation", elapsed)
+	}
+}
+
+func TestWithMaxRetries(t *testing.T) {
+	backoff := func(attempt int) time.Duration { return time.Second }
+
+	type test struct {
+		opts        []ValidatorOption
+		wantRetries int
+		wantBackoff bool
+	}
+
+	tests := map[string]test{
+		"MaxRetries":          {[]ValidatorOption{WithMaxRetries(2)}, 2, false},
+		"Negative":            {[]ValidatorOption{WithMaxRetries(-1)}, 0, false},
+		"MaxRetriesThenRetry": {[]ValidatorOption{WithMaxRetries(2), WithRetry(4, backoff)}, 3, true},
+		"RetryThenMaxRetries": {[]ValidatorOption{WithRetry(4, backoff), WithMaxRetries(2)}, 2, false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			v := NewValidator(tc.opts...)
+			if err := v.Err(); err != nil {
+				t.Fatalf("Validator.Err() error = %v", err)
+			}
+			if v.retries != tc.wantRetries || (v.backoff != nil) != tc.wantBackoff {
+				t.Errorf("NewValidator() = %v retries with backoff %v, want %v retries with backoff %v",
+					v.retries, v.backoff != nil, tc.wantRetries, tc.wantBackoff)
+			}
+		})
+	}
+}
+
+func TestValidator_Validate_RetryAfterDate(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", now.Add(90*time.Second).Format(http.TimeFormat))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, err := NewValidator().Validate(context.Background(), "receipt", testEnv(server.URL))
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("Validator.Validate() error = %v, want *HTTPStatusError", err)
+	}
+	if statusErr.RetryAfter != 90*time.Second {
+		t.Errorf("HTTPStatusError.RetryAfter = %v, want %v", statusErr.RetryAfter, 90*time.Second)
+	}
+}
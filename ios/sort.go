@@ -12,30 +12,61 @@ const (
 	ByPurchaseDate SortType = iota
 	// ByOriginalPurchaseDate represent sort type, which allow sorting by original purchase date.
 	ByOriginalPurchaseDate
+	// ByExpiresDate represent sort type, which allow sorting by subscription expiration date.
+	ByExpiresDate
 )
 
 // Sorted sort InApps array of InApp by different values like:
 // - ByPurchaseDate
 // - ByOriginalPurchaseDate
+// - ByExpiresDate
+//
+// The newest element goes first, elements without the date go last.
+// The sort is stable, so elements with equal dates keep their order.
 func (i InApps) Sorted(by SortType) InApps {
 	switch by {
 	case ByPurchaseDate:
-		sort.Sort(byPurchaseDate(i))
+		sort.Stable(byPurchaseDate(i))
 	case ByOriginalPurchaseDate:
-		sort.Sort(byOriginalPurchaseDate(i))
+		sort.Stable(byOriginalPurchaseDate(i))
+	case ByExpiresDate:
+		sort.Stable(byExpiresDate(i))
 	}
 	return i
 }
 
+// MostRecent return the element with the latest date of the given sort type without changing the order of InApps.
+// If several elements have the same date, the first of them is returned. Returns nil for empty InApps.
+func (i InApps) MostRecent(by SortType) *InApp {
+	var latest *InApp
+	for n := range i {
+		if latest == nil || sortKey(i[n], by) > sortKey(*latest, by) {
+			latest = &i[n]
+		}
+	}
+	return latest
+}
+
+// sortKey return the date of InApp in milliseconds, which is used for the given sort type.
+// Implausible dates are zero, so they never win over the real ones, the same way as in Sorted.
+func sortKey(i InApp, by SortType) int64 {
+	switch by {
+	case ByOriginalPurchaseDate:
+		return plausibleMS(i.OriginalPurchaseDateMS)
+	case ByExpiresDate:
+		return plausibleMS(i.ExpiresDateMS)
+	default:
+		return plausibleMS(i.PurchaseDateMS)
+	}
+}
+
 // byPurchaseDate type implements sort.Interface and used to sort an array of in-apps by purchase date
 type byPurchaseDate InApps
 
 func (b byPurchaseDate) Len() int      { return len(b) }
 func (b byPurchaseDate) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
 func (b byPurchaseDate) Less(i, j int) bool {
-	bi := convertToTime(b[i].PurchaseDateMS)
-	bj := convertToTime(b[j].PurchaseDateMS)
-	return bi.After(bj)
+	return plausibleMS(b[i].PurchaseDateMS) > plausibleMS(b[j].PurchaseDateMS)
 }
 
 // byOriginalPurchaseDate type implements sort.Interface and used to sort an array of in-apps by original purchase date
@@ -44,7 +75,24 @@ type byOriginalPurchaseDate InApps
 func (b byOriginalPurchaseDate) Len() int      { return len(b) }
 func (b byOriginalPurchaseDate) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
 func (b byOriginalPurchaseDate) Less(i, j int) bool {
-	bi := convertToTime(b[i].PurchaseDateMS)
-	bj := convertToTime(b[j].PurchaseDateMS)
-	return bi.After(bj)
+	return plausibleMS(b[i].OriginalPurchaseDateMS) > plausibleMS(b[j].OriginalPurchaseDateMS)
+}
+
+// byExpiresDate type implements sort.Interface and used to sort an array of in-apps by expiration date
+type byExpiresDate InApps
+
+func (b byExpiresDate) Len() int      { return len(b) }
+func (b byExpiresDate) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byExpiresDate) Less(i, j int) bool {
+	return plausibleMS(b[i].ExpiresDateMS) > plausibleMS(b[j].ExpiresDateMS)
+}
+
+// plausibleMS return the timestamp in milliseconds or zero if the timestamp is implausible,
+// the same way as convertToTime does, but without the conversion. Comparators use it,
+// so zero and malformed dates sink to the end of the sorted array.
+func plausibleMS(timeMS int64) int64 {
+	if timeMS < minTimeMS || timeMS > maxTimeMS {
+		return 0
+	}
+	return timeMS
 }
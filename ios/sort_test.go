@@ -2,6 +2,7 @@ package ios
 
 import (
 	"testing"
+	"time"
 )
 
 func TestInApps_Sorted(t *testing.T) {
@@ -62,3 +63,174 @@ func TestInApps_Sorted(t *testing.T) {
 	})
 
 }
+
+func TestInApps_MostRecent(t *testing.T) {
+	inapps := InApps{
+		{TransactionID: "1", OriginalPurchaseDateMS: 1527811200000, PurchaseDateMS: 1527811200000},
+		{TransactionID: "2", OriginalPurchaseDateMS: 1527811200005, PurchaseDateMS: 1527811200001},
+		{TransactionID: "3", OriginalPurchaseDateMS: 1527811200001, PurchaseDateMS: 1527811200009},
+		{TransactionID: "4", OriginalPurchaseDateMS: 1527811200002, PurchaseDateMS: 1527811200002},
+	}
+
+	type args struct {
+		by SortType
+	}
+	type test struct {
+		args args
+		want string
+	}
+
+	tests := map[string]test{
+		"ByPurchaseDate":         {args{by: ByPurchaseDate}, "3"},
+		"ByOriginalPurchaseDate": {args{by: ByOriginalPurchaseDate}, "2"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := inapps.MostRecent(tc.args.by)
+			if got == nil || got.TransactionID != tc.want {
+				t.Errorf("InApps.MostRecent() = %v, want transaction %v", got, tc.want)
+			}
+			if inapps[0].TransactionID != "1" || inapps[3].TransactionID != "4" {
+				t.Errorf("InApps.MostRecent() should not change the order of elements")
+			}
+		})
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		if got := (InApps{}).MostRecent(ByPurchaseDate); got != nil {
+			t.Errorf("InApps.MostRecent() = %v, want nil", got)
+		}
+	})
+}
+
+func TestInApps_SortedBy(t *testing.T) {
+	inapps := InApps{
+		{TransactionID: "1", PurchaseDateMS: 1527811200003, OriginalPurchaseDateMS: 1527811200000, ExpiresDateMS: 1527811200005},
+		{TransactionID: "2", PurchaseDateMS: 1527811200001, OriginalPurchaseDateMS: 1527811200002, ExpiresDateMS: 1527811200005},
+		{TransactionID: "3", PurchaseDateMS: 1527811200002, OriginalPurchaseDateMS: 1527811200001, ExpiresDateMS: 1527811200009},
+		{TransactionID: "4", PurchaseDateMS: 1527811200003, OriginalPurchaseDateMS: 1527811200002},
+	}
+
+	type args struct {
+		by SortType
+	}
+	type test struct {
+		args args
+		want []string
+	}
+
+	tests := map[string]test{
+		"ByPurchaseDate":         {args{by: ByPurchaseDate}, []string{"1", "4", "3", "2"}},
+		"ByOriginalPurchaseDate": {args{by: ByOriginalPurchaseDate}, []string{"2", "4", "3", "1"}},
+		"ByExpiresDate":          {args{by: ByExpiresDate}, []string{"3", "1", "2", "4"}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := append(InApps(nil), inapps...).Sorted(tc.args.by)
+			for n, id := range tc.want {
+				if got[n].TransactionID != id {
+					t.Fatalf("InApps.Sorted() = %v, want transactions in order %v", got, tc.want)
+				}
+			}
+			if latest := inapps.MostRecent(tc.args.by); latest.TransactionID != tc.want[0] {
+				t.Errorf("InApps.MostRecent() = %v, want transaction %v", latest, tc.want[0])
+			}
+		})
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		if got := (InApps{}).Sorted(ByExpiresDate); len(got) != 0 {
+			t.Errorf("InApps.Sorted() = %v, want empty", got)
+		}
+		if got := InApps(nil).Sorted(ByPurchaseDate); got != nil {
+			t.Errorf("InApps.Sorted() = %v, want nil", got)
+		}
+	})
+}
+
+func TestInApps_SortedZeroLast(t *testing.T) {
+	inapps := InApps{
+		{TransactionID: "zero"},
+		{TransactionID: "1", PurchaseDateMS: 1527811200000},
+		{TransactionID: "malformed", PurchaseDateMS: 1 << 60},
+		{TransactionID: "2", PurchaseDateMS: 1527811200001},
+	}
+
+	got := inapps.Sorted(ByPurchaseDate)
+	if got[0].TransactionID != "2" || got[1].TransactionID != "1" {
+		t.Errorf("InApps.Sorted() = %v, want transactions 2 and 1 first", got)
+	}
+	for _, inapp := range got[2:] {
+		if inapp.TransactionID != "zero" && inapp.TransactionID != "malformed" {
+			t.Errorf("InApps.Sorted() = %v, want zero and malformed dates last", got)
+		}
+	}
+}
+
+func TestInApps_MostRecentImplausible(t *testing.T) {
+	type test struct {
+		by     SortType
+		inapps InApps
+	}
+
+	tests := map[string]test{
+		"ByPurchaseDate": {ByPurchaseDate, InApps{
+			{TransactionID: "future", PurchaseDateMS: 1 << 60},
+			{TransactionID: "valid", PurchaseDateMS: 1527811200000},
+			{TransactionID: "negative", PurchaseDateMS: -1527811200000},
+		}},
+		"ByOriginalPurchaseDate": {ByOriginalPurchaseDate, InApps{
+			{TransactionID: "negative", OriginalPurchaseDateMS: -1},
+			{TransactionID: "future", OriginalPurchaseDateMS: 1 << 60},
+			{TransactionID: "valid", OriginalPurchaseDateMS: 1527811200000},
+		}},
+		"ByExpiresDate": {ByExpiresDate, InApps{
+			{TransactionID: "future", ExpiresDateMS: 1 << 60},
+			{TransactionID: "negative", ExpiresDateMS: -1},
+			{TransactionID: "valid", ExpiresDateMS: 1527811200000},
+		}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.inapps.MostRecent(tc.by); got == nil || got.TransactionID != "valid" {
+				t.Errorf("InApps.MostRecent() = %v, want the valid transaction", got)
+			}
+		})
+	}
+
+	latest := InApps{{TransactionID: "future", PurchaseDateMS: 1 << 60}, {TransactionID: "valid", PurchaseDateMS: 1527811200000}}.LatestInApp()
+	if latest == nil || latest.TransactionID != "valid" {
+		t.Errorf("InApps.LatestInApp() = %v, want the valid transaction", latest)
+	}
+}
+
+func BenchmarkSortLargeInApps(b *testing.B) {
+	const size = 5000
+
+	inapps := make(InApps, size)
+	for n := range inapps {
+		// Pseudo-random but deterministic order of dates.
+		ms := int64(1527811200000) + int64(n*7919%size)*int64(time.Hour/time.Millisecond)
+		inapps[n] = InApp{PurchaseDateMS: ms, OriginalPurchaseDateMS: ms}
+	}
+
+	sortTypes := map[string]SortType{
+		"ByPurchaseDate":         ByPurchaseDate,
+		"ByOriginalPurchaseDate": ByOriginalPurchaseDate,
+	}
+
+	for name, by := range sortTypes {
+		by := by
+		b.Run(name, func(b *testing.B) {
+			sorted := make(InApps, size)
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				copy(sorted, inapps)
+				sorted.Sorted(by)
+			}
+		})
+	}
+}
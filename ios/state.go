@@ -0,0 +1,90 @@
+package ios
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// stateVersion represents the version of state encoding produced by MarshalState.
+// It should be increased on every incompatible change of the state type.
+const stateVersion byte = 1
+
+var (
+	ErrEmptyState          = errors.New("state is empty")
+	ErrUnknownStateVersion = errors.New("state has unknown encoding version")
+)
+
+// state type represents the part of ValidationResponse, which is needed for entitlement decisions.
+type state struct {
+	Status       int                 `json:"status"`
+	Environment  int                 `json:"environment"`
+	Subscription *InApp              `json:"subscription,omitempty"`
+	Renewal      *PendingRenewalInfo `json:"renewal,omitempty"`
+}
+
+// MarshalState encodes the compact state of ValidationResponse: status, environment,
+// the latest subscription transaction and its pending renewal info.
+// The first byte of the result is the encoding version, the rest is JSON.
+// Use UnmarshalState to decode the result.
+func (r *ValidationResponse) MarshalState() ([]byte, error) {
+	s := state{
+		Status:      r.Status,
+		Environment: int(r.Environment),
+	}
+
+	if latest := r.LatestReceiptInfo.subscriptions().LatestInApp(); latest != nil {
+		s.Subscription = &InApp{
+			ProductID:              latest.ProductID,
+			TransactionID:          latest.TransactionID,
+			OriginalTransactionID:  latest.OriginalTransactionID,
+			PurchaseDateMS:         latest.PurchaseDateMS,
+			OriginalPurchaseDateMS: latest.OriginalPurchaseDateMS,
+			ExpiresDateMS:          latest.ExpiresDateMS,
+			CancellationDateMS:     latest.CancellationDateMS,
+			CancellationReason:     latest.CancellationReason,
+			IsTrialPeriod:          latest.IsTrialPeriod,
+			IsInIntroOfferPeriod:   latest.IsInIntroOfferPeriod,
+			IsInBillingRetryPeriod: latest.IsInBillingRetryPeriod,
+			AutoRenewStatus:        latest.AutoRenewStatus,
+		}
+		if info, ok := r.PendingRenewalInfo.find(latest.ProductID); ok {
+			s.Renewal = &info
+		}
+	}
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("state encoding error: %v", err)
+	}
+	return append([]byte{stateVersion}, b...), nil
+}
+
+// UnmarshalState decodes the state produced by MarshalState to ValidationResponse.
+// Only the fields persisted by MarshalState are populated.
+// Returns ErrUnknownStateVersion if the state was encoded by incompatible version.
+func UnmarshalState(b []byte) (*ValidationResponse, error) {
+	if len(b) == 0 {
+		return nil, ErrEmptyState
+	}
+	if b[0] != stateVersion {
+		return nil, ErrUnknownStateVersion
+	}
+
+	var s state
+	if err := json.Unmarshal(b[1:], &s); err != nil {
+		return nil, fmt.Errorf("state decoding error: %v", err)
+	}
+
+	response := ValidationResponse{
+		Status:      s.Status,
+		Environment: AppleEnv(s.Environment),
+	}
+	if s.Subscription != nil {
+		response.LatestReceiptInfo = InApps{*s.Subscription}
+	}
+	if s.Renewal != nil {
+		response.PendingRenewalInfo = PendingRenewalInfos{*s.Renewal}
+	}
+	return &response, nil
+}
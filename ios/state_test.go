@@ -0,0 +1,63 @@
+package ios
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidationResponse_MarshalState(t *testing.T) {
+	response := ValidationResponse{
+		Status:        0,
+		Environment:   Sandbox,
+		LatestReceipt: "base64",
+		LatestReceiptInfo: InApps{
+			{ProductID: "monthly", TransactionID: "1", OriginalTransactionID: "1", PurchaseDateMS: 1527811200000, ExpiresDateMS: 1530403200000},
+			{ProductID: "monthly", TransactionID: "2", OriginalTransactionID: "1", PurchaseDateMS: 1530403200000, ExpiresDateMS: 1532995200000},
+		},
+		PendingRenewalInfo: PendingRenewalInfos{
+			{ProductID: "monthly", SubscriptionAutoRenewStatus: "1"},
+		},
+	}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		b, err := response.MarshalState()
+		if err != nil {
+			t.Fatalf("ValidationResponse.MarshalState() error = %v", err)
+		}
+
+		got, err := UnmarshalState(b)
+		if err != nil {
+			t.Fatalf("UnmarshalState() error = %v", err)
+		}
+
+		want := &ValidationResponse{
+			Status:      0,
+			Environment: Sandbox,
+			LatestReceiptInfo: InApps{
+				{ProductID: "monthly", TransactionID: "2", OriginalTransactionID: "1", PurchaseDateMS: 1530403200000, ExpiresDateMS: 1532995200000},
+			},
+			PendingRenewalInfo: response.PendingRenewalInfo,
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("UnmarshalState() = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("VersionMismatch", func(t *testing.T) {
+		b, err := response.MarshalState()
+		if err != nil {
+			t.Fatalf("ValidationResponse.MarshalState() error = %v", err)
+		}
+		b[0] = stateVersion + 1
+
+		if _, err := UnmarshalState(b); err != ErrUnknownStateVersion {
+			t.Errorf("UnmarshalState() error = %v, want %v", err, ErrUnknownStateVersion)
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		if _, err := UnmarshalState(nil); err != ErrEmptyState {
+			t.Errorf("UnmarshalState() error = %v, want %v", err, ErrEmptyState)
+		}
+	})
+}
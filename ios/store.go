@@ -0,0 +1,68 @@
+package ios
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrStateNotFound is returned by StateStore when there is no state under the key.
+var ErrStateNotFound = errors.New("state not found")
+
+// StateStore interface represents the storage of the latest validation responses, for example per user.
+type StateStore interface {
+	// Get returns the response stored under the key or ErrStateNotFound.
+	Get(key string) (*ValidationResponse, error)
+	// Put stores the response under the key replacing the previous one.
+	Put(key string, r *ValidationResponse) error
+}
+
+// MemoryStateStore type represents in-memory implementation of StateStore interface.
+// It's safe for concurrent use, but keeps the state only during the process lifetime.
+type MemoryStateStore struct {
+	mu     sync.RWMutex
+	states map[string]*ValidationResponse
+}
+
+// NewMemoryStateStore return a new instance of MemoryStateStore type.
+func NewMemoryStateStore() *MemoryStateStore {
+	return &MemoryStateStore{states: make(map[string]*ValidationResponse)}
+}
+
+// Get returns the copy of the response stored under the key or ErrStateNotFound.
+func (m *MemoryStateStore) Get(key string) (*ValidationResponse, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	r, ok := m.states[key]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+	c := *r
+	return &c, nil
+}
+
+// Put stores the copy of the response under the key.
+func (m *MemoryStateStore) Put(key string, r *ValidationResponse) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := *r
+	m.states[key] = &c
+	return nil
+}
+
+// ValidateAndStore does the same as ValidateDefault and stores the valid response under the given key.
+// Invalid responses are returned, but not stored, so they don't overwrite the last known good state.
+func (v *Validator) ValidateAndStore(ctx context.Context, key, receipt string, store StateStore) (*ValidationResponse, error) {
+	resp, err := v.ValidateDefault(ctx, receipt)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.IsValid() {
+		return resp, nil
+	}
+	if err := store.Put(key, resp); err != nil {
+		return nil, fmt.Errorf("state storing error: %v", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,69 @@
+package ios
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type failingStateStore struct{}
+
+func (failingStateStore) Get(string) (*ValidationResponse, error) {
+	return nil, errors.New("storage failure")
+}
+func (failingStateStore) Put(string, *ValidationResponse) error { return errors.New("storage failure") }
+
+func TestValidator_ValidateAndStore(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ValidationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("can't decode request body: %v", err)
+		}
+		if req.ReceiptData == "malformed" {
+			fmt.Fprint(w, `{"status":21002}`)
+			return
+		}
+		fmt.Fprint(w, `{"status":0,"latest_receipt":"latest"}`)
+	}))
+	defer server.Close()
+
+	v := NewValidator(WithDefaultEnv(testEnv(server.URL)))
+	store := NewMemoryStateStore()
+
+	if _, err := store.Get("user"); err != ErrStateNotFound {
+		t.Fatalf("MemoryStateStore.Get() error = %v, want %v", err, ErrStateNotFound)
+	}
+
+	resp, err := v.ValidateAndStore(context.Background(), "user", "receipt", store)
+	if err != nil {
+		t.Fatalf("Validator.ValidateAndStore() error = %v", err)
+	}
+
+	stored, err := store.Get("user")
+	if err != nil {
+		t.Fatalf("MemoryStateStore.Get() error = %v", err)
+	}
+	if stored.LatestReceipt != resp.LatestReceipt || stored.Status != resp.Status {
+		t.Errorf("MemoryStateStore.Get() = %+v, want %+v", stored, resp)
+	}
+
+	t.Run("InvalidNotStored", func(t *testing.T) {
+		resp, err := v.ValidateAndStore(context.Background(), "user", "malformed", store)
+		if err != nil || resp.Status != 21002 {
+			t.Fatalf("Validator.ValidateAndStore() = %v, %v, want status 21002", resp, err)
+		}
+		if stored, _ := store.Get("user"); stored.Status != 0 {
+			t.Errorf("MemoryStateStore.Get().Status = %v, want 0", stored.Status)
+		}
+	})
+
+	t.Run("StoreError", func(t *testing.T) {
+		if _, err := v.ValidateAndStore(context.Background(), "user", "receipt", failingStateStore{}); err == nil {
+			t.Errorf("Validator.ValidateAndStore() error = nil, want storing error")
+		}
+	})
+}
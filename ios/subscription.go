@@ -0,0 +1,405 @@
+package ios
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNoSubscription is returned when the response is valid, but contains no auto-renewable subscriptions,
+// for example when the user bought only consumables.
+var ErrNoSubscription = errors.New("receipt contains no auto-renewable subscription")
+
+// LatestSubscription returns the most recently purchased auto-renewable subscription transaction
+// across all sections of the response. The status error is returned if the response isn't valid,
+// and ErrNoSubscription is returned if the valid response has no auto-renewable transactions.
+func (r *ValidationResponse) LatestSubscription() (*InApp, error) {
+	if !r.IsValid() {
+		return nil, r.StatusError()
+	}
+
+	latest := r.AllTransactions().filter(InApp.IsAutoRenewable).LatestInApp()
+	if latest == nil {
+		return nil, ErrNoSubscription
+	}
+	return latest, nil
+}
+
+// ActiveSubscription returns the active auto-renewable subscription transaction with the latest expiration date,
+// see ActiveSubscriptions for the rules. Returns nil if there is no active subscription.
+func (r *ValidationResponse) ActiveSubscription() *InApp {
+	active := r.ActiveSubscriptions()
+	if len(active) == 0 {
+		return nil
+	}
+	return &active[0]
+}
+
+// ActiveSubscriptions returns the active auto-renewable subscription transactions, one per product,
+// sorted by expiration date with the latest first. It's useful for apps with several subscription groups.
+//
+// The transaction of the product with the latest expiration date is active if it wasn't refunded and either
+// it isn't expired yet or its matching pending renewal info reports that the App Store is still trying
+// to renew the subscription (billing retry), in which case the expiration date is in the past.
+func (r *ValidationResponse) ActiveSubscriptions() InApps {
+	var active InApps
+	for _, inapps := range r.LatestReceiptInfo.filter(InApp.IsAutoRenewable).groupByProduct() {
+		latest := inapps.MostRecent(ByExpiresDate)
+		if latest.ExpiresDateMS == 0 || latest.Refunded() {
+			continue
+		}
+		if latest.Expired() {
+			info, ok := r.PendingRenewalInfo.forInApp(*latest)
+			if !ok || info.SubscriptionRetryFlag != "1" {
+				continue
+			}
+		}
+		active = append(active, *latest)
+	}
+	return active.Sorted(ByExpiresDate)
+}
+
+// EffectiveStatus returns the status of the latest transaction of the given product
+// reconciled with the pending renewal info.
+//
+// An expired transaction whose pending renewal has auto-renew turned on and no expiration intent
+// is most likely in the middle of renewal, so it is reported as Pending instead of Expired.
+// If the response has no transactions of the given product, Expired is returned.
+func (r *ValidationResponse) EffectiveStatus(productID string) SubscriptionStatus {
+	latest := r.LatestReceiptInfo.subscriptions().byProduct(productID).LatestInApp()
+	if latest == nil {
+		return Expired
+	}
+
+	status := latest.Status()
+	if status != Expired {
+		return status
+	}
+
+	info, ok := r.PendingRenewalInfo.find(productID)
+	if ok && info.SubscriptionAutoRenewStatus == "1" && info.SubscriptionExpirationIntent == "" {
+		return Pending
+	}
+	return status
+}
+
+// NextProductID returns the product, which the subscription lineage with the given original transaction id
+// will renew to. When a user downgrades or crossgrades, the pending renewal info names the next product,
+// otherwise the product of the latest transaction is returned.
+// The second return value is false if the response has no transactions of the given lineage.
+func (r *ValidationResponse) NextProductID(originalTransactionID string) (string, bool) {
+	latest := r.LatestReceiptInfo.subscriptions().filter(func(i InApp) bool {
+		return i.OriginalTransactionID == originalTransactionID
+	}).LatestInApp()
+	if latest == nil {
+		return "", false
+	}
+
+	info, ok := r.PendingRenewalInfo.findByOriginalTransactionID(originalTransactionID)
+	if ok && info.SubscriptionAutoRenewProductID != "" {
+		return info.SubscriptionAutoRenewProductID, true
+	}
+	return latest.ProductID, true
+}
+
+// ConsistentExpiry returns false if the expiration date of the latest transaction contradicts
+// the pending renewal info by more than the given tolerance. Apple processes renewals asynchronously,
+// so the latest_receipt_info could lag behind the pending renewal info for a few seconds.
+// Inconsistent responses are worth logging for further investigation.
+//
+// The expiration date of a subscription with expiration intent can't be in the future,
+// and the expiration date of a subscription, which will renew and isn't in billing retry, can't be in the past.
+// Responses without transactions or pending renewal info are considered consistent.
+func (r *ValidationResponse) ConsistentExpiry(tolerance time.Duration) bool {
+	latest := r.LatestReceiptInfo.subscriptions().LatestInApp()
+	if latest == nil || latest.ExpiresDateMS == 0 {
+		return true
+	}
+
+	info, ok := r.PendingRenewalInfo.forInApp(*latest)
+	if !ok {
+		return true
+	}
+
+	expires := convertToTime(latest.ExpiresDateMS)
+	now := timeNow()
+
+	switch {
+	case info.SubscriptionExpirationIntent != "":
+		return !expires.After(now.Add(tolerance))
+	case info.SubscriptionAutoRenewStatus == "1" && info.SubscriptionRetryFlag != "1":
+		return !expires.Before(now.Add(-tolerance))
+	default:
+		return true
+	}
+}
+
+// lapseWindow is the period after the end of grace period, during which a subscription is considered just lapsed.
+const lapseWindow = 24 * time.Hour
+
+// JustLapsed returns true if the latest subscription has auto-renew turned off and its grace period,
+// which starts at the expiration date and lasts for the given duration, ended within the last 24 hours.
+// It's useful to start win-back campaigns right after the user lost access.
+// Subscriptions, which lapsed earlier, are not reported to avoid contacting the same user twice.
+func (r *ValidationResponse) JustLapsed(grace time.Duration) bool {
+	latest := r.LatestReceiptInfo.subscriptions().LatestInApp()
+	if latest == nil || latest.ExpiresDateMS == 0 {
+		return false
+	}
+
+	if info, ok := r.PendingRenewalInfo.forInApp(*latest); ok && info.SubscriptionAutoRenewStatus == "1" {
+		return false
+	}
+
+	lapsed := convertToTime(latest.ExpiresDateMS).Add(grace)
+	now := timeNow()
+	return !lapsed.After(now) && now.Sub(lapsed) <= lapseWindow
+}
+
+// ExpiredSubscription type represents the expired subscription product and the reason of expiration.
+type ExpiredSubscription struct {
+	ProductID string
+	ExpiresAt time.Time
+	Intent    ExpirationIntent
+}
+
+// ExpiredSubscriptions returns the products, which latest transaction is expired, with the expiration reason.
+// The reason is taken from the transaction itself or from the matching pending renewal info.
+func (r *ValidationResponse) ExpiredSubscriptions() []ExpiredSubscription {
+	var expired []ExpiredSubscription
+	for _, latest := range r.LatestReceiptInfo.subscriptions().latestByProduct() {
+		if latest.ExpiresDateMS == 0 || !latest.Expired() {
+			continue
+		}
+
+		intent := latest.ExpirationIntent
+		if info, ok := r.PendingRenewalInfo.forInApp(latest); ok && intent == "" {
+			intent = info.SubscriptionExpirationIntent
+		}
+
+		expired = append(expired, ExpiredSubscription{
+			ProductID: latest.ProductID,
+			ExpiresAt: convertToTime(latest.ExpiresDateMS),
+			Intent:    parseExpirationIntent(intent),
+		})
+	}
+	return expired
+}
+
+// TrialEligible returns false if any transaction of the given subscription group products was in a free trial
+// or an introductory offer period, because Apple doesn't offer a trial again within the same subscription group.
+// If no products are given, all transactions of the receipt are checked.
+func (r *ValidationResponse) TrialEligible(groupProductIDs ...string) bool {
+	group := make(map[string]bool, len(groupProductIDs))
+	for _, id := range groupProductIDs {
+		group[id] = true
+	}
+
+	for _, transactions := range []InApps{r.Receipt.InApp, r.LatestReceiptInfo} {
+		for _, inapp := range transactions {
+			if len(group) > 0 && !group[inapp.ProductID] {
+				continue
+			}
+			if inapp.IsTrialPeriod || inapp.IsInIntroOfferPeriod {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// OfferEligibility type represents the subscription offers, which could be presented to the user
+// within a subscription group.
+type OfferEligibility struct {
+	TrialEligible bool
+	IntroEligible bool
+	PromoEligible bool
+}
+
+// OfferEligibility returns the offer eligibility of the user within the given subscription group,
+// computed from the transactions with the matching subscription_group_identifier.
+// The user isn't eligible for a free trial or an introductory offer if any transaction of the group
+// was in a trial or an introductory offer period. Promotional offers are available only to current
+// and lapsed subscribers, so the user is eligible for them if the group has any transaction.
+func (r *ValidationResponse) OfferEligibility(groupID string) OfferEligibility {
+	eligibility := OfferEligibility{TrialEligible: true, IntroEligible: true}
+	for _, inapp := range r.AllTransactions() {
+		if inapp.SubscriptionGroupIdentifier != groupID {
+			continue
+		}
+		eligibility.PromoEligible = true
+		if inapp.IsTrialPeriod || inapp.IsInIntroOfferPeriod {
+			eligibility.TrialEligible = false
+			eligibility.IntroEligible = false
+		}
+	}
+	return eligibility
+}
+
+// EnrichedTransaction type represents the latest transaction of a product joined with its pending renewal info.
+type EnrichedTransaction struct {
+	Transaction InApp
+	// HasRenewalInfo is false when the response has no pending renewal info for the transaction.
+	// In that case the renewal fields are taken from the transaction itself.
+	HasRenewalInfo   bool
+	AutoRenew        bool
+	ExpirationIntent ExpirationIntent
+	InBillingRetry   bool
+	PriceConsent     PriceConsentStatus
+}
+
+// EnrichedTransactions returns the latest transaction of each product joined with the matching pending renewal info.
+// Transactions are matched with pending renewal info by original transaction id or by product id.
+func (r *ValidationResponse) EnrichedTransactions() []EnrichedTransaction {
+	var enriched []EnrichedTransaction
+	for _, latest := range r.LatestReceiptInfo.subscriptions().latestByProduct() {
+		autoRenew := latest.AutoRenewStatus
+		intent := latest.ExpirationIntent
+		retry := latest.IsInBillingRetryPeriod
+		consent := latest.PriceConsentStatus
+
+		info, ok := r.PendingRenewalInfo.forInApp(latest)
+		if ok {
+			autoRenew = info.SubscriptionAutoRenewStatus
+			intent = info.SubscriptionExpirationIntent
+			retry = info.SubscriptionRetryFlag
+			consent = info.SubscriptionPriceConsentStatus
+		}
+
+		enriched = append(enriched, EnrichedTransaction{
+			Transaction:      latest,
+			HasRenewalInfo:   ok,
+			AutoRenew:        autoRenew == "1",
+			ExpirationIntent: parseExpirationIntent(intent),
+			InBillingRetry:   retry == "1",
+			PriceConsent:     parsePriceConsentStatus(consent),
+		})
+	}
+	return enriched
+}
+
+// Entitlement type represents the access state of a subscription product.
+type Entitlement struct {
+	Active    bool
+	ExpiresAt time.Time
+	AutoRenew bool
+}
+
+// Entitlements returns the access state of each product built from the latest transaction of the product.
+// The product is active if its latest transaction isn't expired and wasn't refunded.
+// The auto-renew flag is taken from the matching pending renewal info or from the transaction itself.
+func (r *ValidationResponse) Entitlements() map[string]Entitlement {
+	entitlements := make(map[string]Entitlement)
+	for _, latest := range r.LatestReceiptInfo.subscriptions().latestByProduct() {
+		autoRenew := latest.AutoRenewStatus
+		if info, ok := r.PendingRenewalInfo.forInApp(latest); ok {
+			autoRenew = info.SubscriptionAutoRenewStatus
+		}
+
+		entitlements[latest.ProductID] = Entitlement{
+			Active:    latest.ExpiresDateMS > 0 && !latest.Expired() && !latest.Refunded(),
+			ExpiresAt: convertToTime(latest.ExpiresDateMS),
+			AutoRenew: autoRenew == "1",
+		}
+	}
+	return entitlements
+}
+
+// HighestActiveTier returns the active product with the highest level from the given levels,
+// which is useful to gate upsell prompts in apps with tiered plans. Products missing from the levels
+// are ignored. If several products have the same level, the first of them in lexical order is returned.
+// The third return value is false if none of the leveled products is active.
+func (r *ValidationResponse) HighestActiveTier(levels map[string]int) (productID string, level int, ok bool) {
+	for product, entitlement := range r.Entitlements() {
+		l, leveled := levels[product]
+		if !leveled || !entitlement.Active {
+			continue
+		}
+		if !ok || l > level || (l == level && product < productID) {
+			productID, level, ok = product, l, true
+		}
+	}
+	return productID, level, ok
+}
+
+// ChurnSignals type represents the signals of the subscription, which is likely to churn.
+type ChurnSignals struct {
+	AutoRenewOff         bool
+	InBillingRetry       bool
+	PriceIncreasePending bool
+	// ExpiresAt is the expiration date of the latest transaction, zero if the product has no transactions.
+	ExpiresAt time.Time
+}
+
+// ExpiringSoon returns true if the subscription is still active, but expires within the given duration.
+func (c ChurnSignals) ExpiringSoon(within time.Duration) bool {
+	now := timeNow()
+	return c.ExpiresAt.After(now) && !c.ExpiresAt.After(now.Add(within))
+}
+
+// ChurnSignals returns the churn signals of the given product computed from its latest transaction
+// and the matching pending renewal info, or from the transaction itself if there is no renewal info.
+func (r *ValidationResponse) ChurnSignals(productID string) ChurnSignals {
+	latest := r.LatestReceiptInfo.subscriptions().byProduct(productID).LatestInApp()
+	if latest == nil {
+		return ChurnSignals{}
+	}
+
+	autoRenew := latest.AutoRenewStatus
+	retry := latest.IsInBillingRetryPeriod
+	consent := latest.PriceConsentStatus
+	if info, ok := r.PendingRenewalInfo.forInApp(*latest); ok {
+		autoRenew = info.SubscriptionAutoRenewStatus
+		retry = info.SubscriptionRetryFlag
+		consent = info.SubscriptionPriceConsentStatus
+	}
+
+	return ChurnSignals{
+		AutoRenewOff:         autoRenew == "0",
+		InBillingRetry:       retry == "1",
+		PriceIncreasePending: parsePriceConsentStatus(consent) == PriceConsentPending,
+		ExpiresAt:            convertToTime(latest.ExpiresDateMS),
+	}
+}
+
+// Reactivated returns true if auto-renew of the given product was turned off and then turned back on.
+// Unlike InApps.Reactivated, the current auto-renew status from the pending renewal info of the latest
+// transaction is taken into account, so the reactivation is detected before the next renewal happens.
+// See InApps.Reactivated for the requirements to the receipt.
+func (r *ValidationResponse) Reactivated(productID string) bool {
+	inapps := r.LatestReceiptInfo.subscriptions().byProduct(productID)
+	history := inapps.autoRenewHistory(productID)
+	if latest := inapps.LatestInApp(); latest != nil {
+		if info, ok := r.PendingRenewalInfo.forInApp(*latest); ok && info.SubscriptionAutoRenewStatus != "" {
+			history = append(history, info.SubscriptionAutoRenewStatus)
+		}
+	}
+	return reactivated(history)
+}
+
+// ExpectedNextNotification returns the notification, which the App Store is expected to send next
+// for the active subscription of the given product, and the approximate time of it, so a missing
+// webhook could be alerted on. With auto-renew on, DID_RENEW is expected at the expiration date,
+// with auto-renew off, the subscription ends at the expiration date with EXPIRED notification.
+// The auto-renew status is taken from the matching pending renewal info or from the transaction itself.
+// The third return value is false if the product isn't active or its auto-renew status is unknown.
+func (r *ValidationResponse) ExpectedNextNotification(productID string) (NotificationType, time.Time, bool) {
+	latest := r.LatestReceiptInfo.subscriptions().byProduct(productID).LatestInApp()
+	if latest == nil || latest.ExpiresDateMS == 0 || latest.Expired() || latest.Refunded() {
+		return "", time.Time{}, false
+	}
+
+	autoRenew := latest.AutoRenewStatus
+	if info, ok := r.PendingRenewalInfo.forInApp(*latest); ok {
+		autoRenew = info.SubscriptionAutoRenewStatus
+	}
+
+	expiresAt := convertToTime(latest.ExpiresDateMS)
+	switch autoRenew {
+	case "1":
+		return NotificationDidRenew, expiresAt, true
+	case "0":
+		return NotificationExpired, expiresAt, true
+	default:
+		return "", time.Time{}, false
+	}
+}
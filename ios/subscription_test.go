@@ -0,0 +1,749 @@
+package ios
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// timeMS convert Go time.Time to unix timestamp in milliseconds
+func timeMS(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func TestValidationResponse_ActiveSubscription(t *testing.T) {
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	month := 30 * 24 * time.Hour
+	subscription := func(id, product string, expires time.Time) InApp {
+		return InApp{
+			TransactionID:         id,
+			OriginalTransactionID: product,
+			ProductID:             product,
+			WebOrderLineItemID:    id,
+			PurchaseDateMS:        timeMS(expires.Add(-month)),
+			ExpiresDateMS:         timeMS(expires),
+		}
+	}
+	refunded := subscription("2", "monthly", now.Add(month))
+	refunded.CancellationDateMS = timeMS(now)
+
+	type test struct {
+		response ValidationResponse
+		want     string
+	}
+
+	tests := map[string]test{
+		"Active": {ValidationResponse{LatestReceiptInfo: InApps{
+			subscription("2", "monthly", now.Add(month)),
+			subscription("1", "monthly", now),
+		}}, "2"},
+		"Expired": {ValidationResponse{LatestReceiptInfo: InApps{
+			subscription("1", "monthly", now.Add(-time.Hour)),
+		}}, ""},
+		"BillingRetry": {ValidationResponse{
+			LatestReceiptInfo: InApps{subscription("1", "monthly", now.Add(-time.Hour))},
+			PendingRenewalInfo: PendingRenewalInfos{
+				{ProductID: "monthly", OriginalTransactionID: "monthly", SubscriptionRetryFlag: "1"},
+			},
+		}, "1"},
+		"Refunded": {ValidationResponse{LatestReceiptInfo: InApps{
+			subscription("1", "monthly", now.Add(-month)),
+			refunded,
+		}}, ""},
+		"NonRenewing": {ValidationResponse{LatestReceiptInfo: InApps{
+			{TransactionID: "1", ProductID: "season", PurchaseDateMS: timeMS(now), ExpiresDateMS: timeMS(now.Add(month))},
+		}}, ""},
+		"Empty": {ValidationResponse{}, ""},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := tc.response.ActiveSubscription()
+			if tc.want == "" {
+				if got != nil {
+					t.Errorf("ValidationResponse.ActiveSubscription() = %v, want nil", got)
+				}
+				return
+			}
+			if got == nil || got.TransactionID != tc.want {
+				t.Errorf("ValidationResponse.ActiveSubscription() = %v, want transaction %v", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("SeveralGroups", func(t *testing.T) {
+		response := ValidationResponse{LatestReceiptInfo: InApps{
+			subscription("1", "monthly", now.Add(month)),
+			subscription("2", "yearly", now.Add(12*month)),
+			subscription("3", "news", now.Add(-time.Hour)),
+		}}
+		got := response.ActiveSubscriptions()
+		if len(got) != 2 || got[0].TransactionID != "2" || got[1].TransactionID != "1" {
+			t.Errorf("ValidationResponse.ActiveSubscriptions() = %v, want transactions 2 and 1", got)
+		}
+	})
+}
+
+func TestValidationResponse_EffectiveStatus(t *testing.T) {
+	past := timeMS(time.Now().Add(-time.Hour))
+	future := timeMS(time.Now().Add(time.Hour))
+
+	type args struct {
+		productID string
+	}
+	type test struct {
+		args     args
+		response ValidationResponse
+		want     SubscriptionStatus
+	}
+
+	tests := map[string]test{
+		"ExpiredWillRenew": {
+			args{productID: "monthly"},
+			ValidationResponse{
+				LatestReceiptInfo: InApps{{ProductID: "monthly", PurchaseDateMS: past, ExpiresDateMS: past}},
+				PendingRenewalInfo: PendingRenewalInfos{
+					{ProductID: "monthly", SubscriptionAutoRenewStatus: "1"},
+				},
+			},
+			Pending,
+		},
+		"ExpiredWithIntent": {
+			args{productID: "monthly"},
+			ValidationResponse{
+				LatestReceiptInfo: InApps{{ProductID: "monthly", PurchaseDateMS: past, ExpiresDateMS: past}},
+				PendingRenewalInfo: PendingRenewalInfos{
+					{ProductID: "monthly", SubscriptionAutoRenewStatus: "1", SubscriptionExpirationIntent: "1"},
+				},
+			},
+			Expired,
+		},
+		"ExpiredWithoutPendingRenewal": {
+			args{productID: "monthly"},
+			ValidationResponse{
+				LatestReceiptInfo: InApps{{ProductID: "monthly", PurchaseDateMS: past, ExpiresDateMS: past}},
+			},
+			Expired,
+		},
+		"Active": {
+			args{productID: "monthly"},
+			ValidationResponse{
+				LatestReceiptInfo: InApps{{ProductID: "monthly", PurchaseDateMS: past, ExpiresDateMS: future}},
+			},
+			Paid,
+		},
+		"UnknownProduct": {
+			args{productID: "yearly"},
+			ValidationResponse{
+				LatestReceiptInfo: InApps{{ProductID: "monthly", PurchaseDateMS: past, ExpiresDateMS: future}},
+			},
+			Expired,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.response.EffectiveStatus(tc.args.productID); got != tc.want {
+				t.Errorf("ValidationResponse.EffectiveStatus() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidationResponse_NextProductID(t *testing.T) {
+	response := ValidationResponse{
+		LatestReceiptInfo: InApps{
+			{ProductID: "premium", OriginalTransactionID: "1", PurchaseDateMS: 1527811200000, ExpiresDateMS: 1530403200000},
+			{ProductID: "premium", OriginalTransactionID: "1", PurchaseDateMS: 1530403200000, ExpiresDateMS: 1532995200000},
+			{ProductID: "basic", OriginalTransactionID: "2", PurchaseDateMS: 1530403200000, ExpiresDateMS: 1532995200000},
+		},
+		PendingRenewalInfo: PendingRenewalInfos{
+			{ProductID: "premium", OriginalTransactionID: "1", SubscriptionAutoRenewProductID: "basic"},
+		},
+	}
+
+	type args struct {
+		originalTransactionID string
+	}
+	type test struct {
+		args   args
+		want   string
+		wantOK bool
+	}
+
+	tests := map[string]test{
+		"ScheduledDowngrade": {args{originalTransactionID: "1"}, "basic", true},
+		"NoPendingInfo":      {args{originalTransactionID: "2"}, "basic", true},
+		"UnknownLineage":     {args{originalTransactionID: "3"}, "", false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, ok := response.NextProductID(tc.args.originalTransactionID)
+			if got != tc.want || ok != tc.wantOK {
+				t.Errorf("ValidationResponse.NextProductID() = (%v, %v), want (%v, %v)", got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestValidationResponse_ConsistentExpiry(t *testing.T) {
+	now := time.Now()
+	tolerance := time.Minute
+
+	type test struct {
+		expires time.Time
+		renewal PendingRenewalInfo
+		want    bool
+	}
+
+	tests := map[string]test{
+		"ActiveWillRenew": {
+			now.Add(time.Hour),
+			PendingRenewalInfo{SubscriptionAutoRenewStatus: "1"},
+			true,
+		},
+		"ExpiredWithIntent": {
+			now.Add(-time.Hour),
+			PendingRenewalInfo{SubscriptionAutoRenewStatus: "0", SubscriptionExpirationIntent: "1"},
+			true,
+		},
+		"RenewalLagWithinTolerance": {
+			now.Add(-10 * time.Second),
+			PendingRenewalInfo{SubscriptionAutoRenewStatus: "1"},
+			true,
+		},
+		"ActiveWithIntent": {
+			now.Add(time.Hour),
+			PendingRenewalInfo{SubscriptionAutoRenewStatus: "0", SubscriptionExpirationIntent: "1"},
+			false,
+		},
+		"ExpiredWillRenew": {
+			now.Add(-time.Hour),
+			PendingRenewalInfo{SubscriptionAutoRenewStatus: "1"},
+			false,
+		},
+		"ExpiredInBillingRetry": {
+			now.Add(-time.Hour),
+			PendingRenewalInfo{SubscriptionAutoRenewStatus: "1", SubscriptionRetryFlag: "1"},
+			true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc.renewal.ProductID = "monthly"
+			response := ValidationResponse{
+				LatestReceiptInfo: InApps{{
+					ProductID:      "monthly",
+					PurchaseDateMS: timeMS(tc.expires.Add(-30 * 24 * time.Hour)),
+					ExpiresDateMS:  timeMS(tc.expires),
+				}},
+				PendingRenewalInfo: PendingRenewalInfos{tc.renewal},
+			}
+			if got := response.ConsistentExpiry(tolerance); got != tc.want {
+				t.Errorf("ValidationResponse.ConsistentExpiry() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidationResponse_JustLapsed(t *testing.T) {
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	grace := 16 * 24 * time.Hour
+
+	type test struct {
+		expires   time.Time
+		autoRenew string
+		want      bool
+	}
+
+	tests := map[string]test{
+		"JustLapsed":       {now.Add(-grace - time.Hour), "0", true},
+		"LongLapsed":       {now.Add(-grace - 30*24*time.Hour), "0", false},
+		"InGracePeriod":    {now.Add(-time.Hour), "0", false},
+		"AutoRenewEnabled": {now.Add(-grace - time.Hour), "1", false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			response := ValidationResponse{
+				LatestReceiptInfo: InApps{{
+					ProductID:             "monthly",
+					OriginalTransactionID: "1",
+					PurchaseDateMS:        timeMS(tc.expires.Add(-30 * 24 * time.Hour)),
+					ExpiresDateMS:         timeMS(tc.expires),
+				}},
+				PendingRenewalInfo: PendingRenewalInfos{
+					{ProductID: "monthly", OriginalTransactionID: "1", SubscriptionAutoRenewStatus: tc.autoRenew},
+				},
+			}
+			if got := response.JustLapsed(grace); got != tc.want {
+				t.Errorf("ValidationResponse.JustLapsed() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidationResponse_ExpiredSubscriptions(t *testing.T) {
+	past := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	future := time.Now().Add(time.Hour)
+
+	response := ValidationResponse{
+		LatestReceiptInfo: InApps{
+			{ProductID: "news", PurchaseDateMS: timeMS(past.Add(-time.Hour)), ExpiresDateMS: timeMS(past), ExpirationIntent: "1"},
+			{ProductID: "games", PurchaseDateMS: timeMS(past.Add(-time.Hour)), ExpiresDateMS: timeMS(past)},
+			{ProductID: "music", PurchaseDateMS: timeMS(past), ExpiresDateMS: timeMS(future)},
+		},
+		PendingRenewalInfo: PendingRenewalInfos{
+			{ProductID: "games", SubscriptionExpirationIntent: "2"},
+		},
+	}
+
+	want := []ExpiredSubscription{
+		{ProductID: "news", ExpiresAt: past, Intent: ExpirationIntentCanceled},
+		{ProductID: "games", ExpiresAt: past, Intent: ExpirationIntentBillingError},
+	}
+
+	got := response.ExpiredSubscriptions()
+	if len(got) != len(want) {
+		t.Fatalf("ValidationResponse.ExpiredSubscriptions() = %v, want %v", got, want)
+	}
+	for n := range want {
+		if got[n].ProductID != want[n].ProductID || !got[n].ExpiresAt.Equal(want[n].ExpiresAt) || got[n].Intent != want[n].Intent {
+			t.Errorf("ValidationResponse.ExpiredSubscriptions()[%d] = %+v, want %+v", n, got[n], want[n])
+		}
+	}
+}
+
+func TestValidationResponse_TrialEligible(t *testing.T) {
+	response := ValidationResponse{
+		Receipt: Receipt{
+			InApp: InApps{{ProductID: "news.monthly", IsTrialPeriod: true}},
+		},
+		LatestReceiptInfo: InApps{
+			{ProductID: "news.monthly", IsTrialPeriod: true},
+			{ProductID: "news.monthly"},
+			{ProductID: "games.monthly"},
+			{ProductID: "music.monthly", IsInIntroOfferPeriod: true},
+		},
+	}
+
+	type args struct {
+		group []string
+	}
+	type test struct {
+		args args
+		want bool
+	}
+
+	tests := map[string]test{
+		"PriorTrial":      {args{group: []string{"news.monthly", "news.yearly"}}, false},
+		"PriorIntroOffer": {args{group: []string{"music.monthly"}}, false},
+		"FreshGroup":      {args{group: []string{"games.monthly", "games.yearly"}}, true},
+		"AllProducts":     {args{}, false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := response.TrialEligible(tc.args.group...); got != tc.want {
+				t.Errorf("ValidationResponse.TrialEligible() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidationResponse_EnrichedTransactions(t *testing.T) {
+	news := InApp{ProductID: "news", OriginalTransactionID: "1", PurchaseDateMS: 1527811200000, ExpiresDateMS: 1530403200000}
+	games := InApp{ProductID: "games", OriginalTransactionID: "2", PurchaseDateMS: 1527811200000, AutoRenewStatus: "0", ExpirationIntent: "1"}
+
+	response := ValidationResponse{
+		LatestReceiptInfo: InApps{news, games},
+		PendingRenewalInfo: PendingRenewalInfos{
+			{
+				ProductID:                      "news",
+				OriginalTransactionID:          "1",
+				SubscriptionAutoRenewStatus:    "1",
+				SubscriptionExpirationIntent:   "2",
+				SubscriptionRetryFlag:          "1",
+				SubscriptionPriceConsentStatus: "0",
+			},
+			{ProductID: "music", OriginalTransactionID: "3", SubscriptionAutoRenewStatus: "1"},
+		},
+	}
+
+	want := []EnrichedTransaction{
+		{
+			Transaction:      news,
+			HasRenewalInfo:   true,
+			AutoRenew:        true,
+			ExpirationIntent: ExpirationIntentBillingError,
+			InBillingRetry:   true,
+			PriceConsent:     PriceConsentPending,
+		},
+		{
+			Transaction:      games,
+			HasRenewalInfo:   false,
+			AutoRenew:        false,
+			ExpirationIntent: ExpirationIntentCanceled,
+		},
+	}
+
+	if got := response.EnrichedTransactions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ValidationResponse.EnrichedTransactions() = %+v, want %+v", got, want)
+	}
+}
+
+func TestValidationResponse_Entitlements(t *testing.T) {
+	past := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	future := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+
+	response := ValidationResponse{
+		LatestReceiptInfo: InApps{
+			{ProductID: "news", PurchaseDateMS: timeMS(past.Add(-time.Hour)), ExpiresDateMS: timeMS(past)},
+			{ProductID: "news", PurchaseDateMS: timeMS(past), ExpiresDateMS: timeMS(future)},
+			{ProductID: "games", PurchaseDateMS: timeMS(past), ExpiresDateMS: timeMS(future)},
+			{ProductID: "music", PurchaseDateMS: timeMS(past.Add(-time.Hour)), ExpiresDateMS: timeMS(past)},
+		},
+		PendingRenewalInfo: PendingRenewalInfos{
+			{ProductID: "news", SubscriptionAutoRenewStatus: "1"},
+			{ProductID: "games", SubscriptionAutoRenewStatus: "0"},
+		},
+	}
+
+	want := map[string]Entitlement{
+		"news":  {Active: true, ExpiresAt: future, AutoRenew: true},
+		"games": {Active: true, ExpiresAt: future, AutoRenew: false},
+		"music": {Active: false, ExpiresAt: past, AutoRenew: false},
+	}
+
+	got := response.Entitlements()
+	if len(got) != len(want) {
+		t.Fatalf("ValidationResponse.Entitlements() = %v, want %v", got, want)
+	}
+	for product, entitlement := range want {
+		e := got[product]
+		if e.Active != entitlement.Active || e.AutoRenew != entitlement.AutoRenew || !e.ExpiresAt.Equal(entitlement.ExpiresAt) {
+			t.Errorf("ValidationResponse.Entitlements()[%v] = %+v, want %+v", product, e, entitlement)
+		}
+	}
+}
+
+func TestValidationResponse_HighestActiveTier(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	levels := map[string]int{"basic": 1, "premium": 2, "family": 2}
+
+	type test struct {
+		inapps      InApps
+		wantProduct string
+		wantLevel   int
+		wantOK      bool
+	}
+
+	tests := map[string]test{
+		"TwoTiersActive": {InApps{
+			{ProductID: "basic", PurchaseDateMS: timeMS(past), ExpiresDateMS: timeMS(future)},
+			{ProductID: "premium", PurchaseDateMS: timeMS(past), ExpiresDateMS: timeMS(future)},
+			{ProductID: "unleveled", PurchaseDateMS: timeMS(past), ExpiresDateMS: timeMS(future)},
+		}, "premium", 2, true},
+		"HigherTierExpired": {InApps{
+			{ProductID: "basic", PurchaseDateMS: timeMS(past), ExpiresDateMS: timeMS(future)},
+			{ProductID: "premium", PurchaseDateMS: timeMS(past.Add(-time.Hour)), ExpiresDateMS: timeMS(past)},
+		}, "basic", 1, true},
+		"SameLevel": {InApps{
+			{ProductID: "premium", PurchaseDateMS: timeMS(past), ExpiresDateMS: timeMS(future)},
+			{ProductID: "family", PurchaseDateMS: timeMS(past), ExpiresDateMS: timeMS(future)},
+		}, "family", 2, true},
+		"NoneActive": {InApps{
+			{ProductID: "basic", PurchaseDateMS: timeMS(past.Add(-time.Hour)), ExpiresDateMS: timeMS(past)},
+			{ProductID: "premium", PurchaseDateMS: timeMS(past.Add(-time.Hour)), ExpiresDateMS: timeMS(past)},
+		}, "", 0, false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			response := ValidationResponse{LatestReceiptInfo: tc.inapps}
+			product, level, ok := response.HighestActiveTier(levels)
+			if product != tc.wantProduct || level != tc.wantLevel || ok != tc.wantOK {
+				t.Errorf("ValidationResponse.HighestActiveTier() = (%v, %v, %v), want (%v, %v, %v)",
+					product, level, ok, tc.wantProduct, tc.wantLevel, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestValidationResponse_OfferEligibility(t *testing.T) {
+	response := ValidationResponse{
+		Receipt: Receipt{InApp: InApps{
+			{ProductID: "pro.monthly", TransactionID: "1", PurchaseDateMS: 1000, SubscriptionGroupIdentifier: "20571491", IsTrialPeriod: true},
+		}},
+		LatestReceiptInfo: InApps{
+			{ProductID: "pro.monthly", TransactionID: "2", PurchaseDateMS: 2000, SubscriptionGroupIdentifier: "20571491", IsInIntroOfferPeriod: true},
+			{ProductID: "pro.monthly", TransactionID: "3", PurchaseDateMS: 3000, SubscriptionGroupIdentifier: "20571491"},
+			{ProductID: "basic.monthly", TransactionID: "4", PurchaseDateMS: 3000, SubscriptionGroupIdentifier: "20571492"},
+		},
+	}
+
+	type args struct {
+		groupID string
+	}
+	type test struct {
+		args args
+		want OfferEligibility
+	}
+
+	tests := map[string]test{
+		"PriorTrialAndIntro": {args{groupID: "20571491"}, OfferEligibility{TrialEligible: false, IntroEligible: false, PromoEligible: true}},
+		"PaidOnly":           {args{groupID: "20571492"}, OfferEligibility{TrialEligible: true, IntroEligible: true, PromoEligible: true}},
+		"FreshGroup":         {args{groupID: "20571493"}, OfferEligibility{TrialEligible: true, IntroEligible: true, PromoEligible: false}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := response.OfferEligibility(tc.args.groupID); got != tc.want {
+				t.Errorf("ValidationResponse.OfferEligibility() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidationResponse_LatestSubscription(t *testing.T) {
+	consumable := InApp{ProductID: "coins", TransactionID: "1", Quantity: "5", PurchaseDateMS: 1527811200000}
+	subscription := InApp{ProductID: "monthly", TransactionID: "2", WebOrderLineItemID: "1000000039614547",
+		PurchaseDateMS: 1527811100000, ExpiresDateMS: 1530403100000}
+
+	type test struct {
+		response ValidationResponse
+		want     string
+		wantErr  error
+	}
+
+	tests := map[string]test{
+		"ConsumableOnly": {
+			ValidationResponse{Receipt: Receipt{InApp: InApps{consumable}}},
+			"", ErrNoSubscription,
+		},
+		"Subscription": {
+			ValidationResponse{Receipt: Receipt{InApp: InApps{consumable}}, LatestReceiptInfo: InApps{subscription}},
+			"2", nil,
+		},
+		"Invalid": {
+			ValidationResponse{Status: 21002},
+			"", ErrMalformedReceiptData,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := tc.response.LatestSubscription()
+			if err != tc.wantErr {
+				t.Fatalf("ValidationResponse.LatestSubscription() error = %v, want %v", err, tc.wantErr)
+			}
+			if tc.wantErr == nil && got.TransactionID != tc.want {
+				t.Errorf("ValidationResponse.LatestSubscription().TransactionID = %v, want %v", got.TransactionID, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidationResponse_ChurnSignals(t *testing.T) {
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	type test struct {
+		expires      time.Time
+		renewal      PendingRenewalInfo
+		want         ChurnSignals
+		wantExpiring bool
+	}
+
+	tests := map[string]test{
+		"Healthy": {
+			now.Add(20 * 24 * time.Hour),
+			PendingRenewalInfo{SubscriptionAutoRenewStatus: "1"},
+			ChurnSignals{},
+			false,
+		},
+		"AutoRenewOff": {
+			now.Add(20 * 24 * time.Hour),
+			PendingRenewalInfo{SubscriptionAutoRenewStatus: "0"},
+			ChurnSignals{AutoRenewOff: true},
+			false,
+		},
+		"InBillingRetry": {
+			now.Add(-time.Hour),
+			PendingRenewalInfo{SubscriptionAutoRenewStatus: "1", SubscriptionRetryFlag: "1"},
+			ChurnSignals{InBillingRetry: true},
+			false,
+		},
+		"PriceIncreasePending": {
+			now.Add(20 * 24 * time.Hour),
+			PendingRenewalInfo{SubscriptionAutoRenewStatus: "1", SubscriptionPriceConsentStatus: "0"},
+			ChurnSignals{PriceIncreasePending: true},
+			false,
+		},
+		"ExpiringSoon": {
+			now.Add(2 * 24 * time.Hour),
+			PendingRenewalInfo{SubscriptionAutoRenewStatus: "1"},
+			ChurnSignals{},
+			true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc.renewal.ProductID = "monthly"
+			response := ValidationResponse{
+				LatestReceiptInfo: InApps{{
+					ProductID:      "monthly",
+					PurchaseDateMS: timeMS(tc.expires.Add(-30 * 24 * time.Hour)),
+					ExpiresDateMS:  timeMS(tc.expires),
+				}},
+				PendingRenewalInfo: PendingRenewalInfos{tc.renewal},
+			}
+
+			got := response.ChurnSignals("monthly")
+			tc.want.ExpiresAt = tc.expires
+			if got != tc.want {
+				t.Errorf("ValidationResponse.ChurnSignals() = %+v, want %+v", got, tc.want)
+			}
+			if expiring := got.ExpiringSoon(7 * 24 * time.Hour); expiring != tc.wantExpiring {
+				t.Errorf("ChurnSignals.ExpiringSoon() = %v, want %v", expiring, tc.wantExpiring)
+			}
+		})
+	}
+
+	t.Run("UnknownProduct", func(t *testing.T) {
+		var response ValidationResponse
+		if got := response.ChurnSignals("monthly"); got != (ChurnSignals{}) {
+			t.Errorf("ValidationResponse.ChurnSignals() = %+v, want zero value", got)
+		}
+	})
+}
+
+func TestValidationResponse_SkipsConsumables(t *testing.T) {
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	expires := now.Add(24 * time.Hour)
+	response := ValidationResponse{
+		LatestReceiptInfo: InApps{
+			{ProductID: "monthly", OriginalTransactionID: "1", PurchaseDateMS: timeMS(now.Add(-time.Hour)), ExpiresDateMS: timeMS(expires)},
+			{ProductID: "coins", OriginalTransactionID: "2", PurchaseDateMS: timeMS(now)},
+		},
+		PendingRenewalInfo: PendingRenewalInfos{
+			{ProductID: "monthly", OriginalTransactionID: "1", SubscriptionAutoRenewStatus: "1"},
+		},
+	}
+
+	if got := response.EffectiveStatus("coins"); got != Expired {
+		t.Errorf("ValidationResponse.EffectiveStatus(coins) = %v, want %v", got, Expired)
+	}
+	if got, ok := response.NextProductID("2"); ok {
+		t.Errorf("ValidationResponse.NextProductID(2) = %v, want no product", got)
+	}
+	if !response.ConsistentExpiry(time.Minute) {
+		t.Errorf("ValidationResponse.ConsistentExpiry() = false, want true")
+	}
+	if response.JustLapsed(16 * 24 * time.Hour) {
+		t.Errorf("ValidationResponse.JustLapsed() = true, want false")
+	}
+	if got := response.ExpiredSubscriptions(); len(got) != 0 {
+		t.Errorf("ValidationResponse.ExpiredSubscriptions() = %v, want none", got)
+	}
+	entitlements := response.Entitlements()
+	if _, ok := entitlements["coins"]; ok || len(entitlements) != 1 {
+		t.Errorf("ValidationResponse.Entitlements() = %v, want only monthly", entitlements)
+	}
+	if got := response.EnrichedTransactions(); len(got) != 1 || got[0].Transaction.ProductID != "monthly" {
+		t.Errorf("ValidationResponse.EnrichedTransactions() = %v, want only monthly", got)
+	}
+	if got := response.ChurnSignals("coins"); got != (ChurnSignals{}) {
+		t.Errorf("ValidationResponse.ChurnSignals(coins) = %+v, want zero signals", got)
+	}
+}
+
+func TestValidationResponse_Reactivated(t *testing.T) {
+	type test struct {
+		autoRenew string
+		want      bool
+	}
+
+	tests := map[string]test{
+		"TurnedBackOn": {"1", true},
+		"StillOff":     {"0", false},
+		"NoRenewal":    {"", false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			response := ValidationResponse{
+				LatestReceiptInfo: InApps{
+					{ProductID: "monthly", OriginalTransactionID: "1", PurchaseDateMS: 1527811200000, ExpiresDateMS: 1530403200000, AutoRenewStatus: "1"},
+					{ProductID: "monthly", OriginalTransactionID: "1", PurchaseDateMS: 1530403200000, ExpiresDateMS: 1532995200000, AutoRenewStatus: "0"},
+				},
+			}
+			if tc.autoRenew != "" {
+				response.PendingRenewalInfo = PendingRenewalInfos{
+					{ProductID: "monthly", OriginalTransactionID: "1", SubscriptionAutoRenewStatus: tc.autoRenew},
+				}
+			}
+			if got := response.Reactivated("monthly"); got != tc.want {
+				t.Errorf("ValidationResponse.Reactivated() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidationResponse_ExpectedNextNotification(t *testing.T) {
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	type test struct {
+		expires   time.Time
+		autoRenew string
+		want      NotificationType
+		wantOK    bool
+	}
+
+	tests := map[string]test{
+		"AutoRenewOn":  {now.Add(24 * time.Hour), "1", NotificationDidRenew, true},
+		"AutoRenewOff": {now.Add(24 * time.Hour), "0", NotificationExpired, true},
+		"Unknown":      {now.Add(24 * time.Hour), "", "", false},
+		"Expired":      {now.Add(-24 * time.Hour), "1", "", false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			response := ValidationResponse{
+				LatestReceiptInfo: InApps{{
+					ProductID:             "monthly",
+					OriginalTransactionID: "1",
+					PurchaseDateMS:        timeMS(tc.expires.Add(-30 * 24 * time.Hour)),
+					ExpiresDateMS:         timeMS(tc.expires),
+				}},
+				PendingRenewalInfo: PendingRenewalInfos{
+					{ProductID: "monthly", OriginalTransactionID: "1", SubscriptionAutoRenewStatus: tc.autoRenew},
+				},
+			}
+
+			got, at, ok := response.ExpectedNextNotification("monthly")
+			if got != tc.want || ok != tc.wantOK {
+				t.Fatalf("ValidationResponse.ExpectedNextNotification() = (%v, %v), want (%v, %v)", got, ok, tc.want, tc.wantOK)
+			}
+			if ok && !at.Equal(tc.expires) {
+				t.Errorf("ValidationResponse.ExpectedNextNotification() time = %v, want %v", at, tc.expires)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package ios
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+)
+
+// NewTestServer starts the test server, which mimics the AppStore validation endpoint without network access.
+// The server responds with the canned response keyed by the receipt-data of the request,
+// or with 21002 status (malformed receipt data) for unknown receipts.
+//
+// The returned Env points to the server, so it could be passed to Validate.
+// The caller should close the server when finished.
+func NewTestServer(responses map[string]ValidationResponse) (*httptest.Server, Env) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ValidationRequest
+		response := ValidationResponse{Status: 21000}
+		if err := json.NewDecoder(r.Body).Decode(&req); err == nil {
+			canned, ok := responses[req.ReceiptData]
+			if !ok {
+				canned = ValidationResponse{Status: 21002}
+			}
+			response = canned
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}))
+	return server, urlEnv(server.URL)
+}
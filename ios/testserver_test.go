@@ -0,0 +1,315 @@
+package ios
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// routeTransport type implements http.RoundTripper and used to redirect requests
+// to different test servers depending on the requested host.
+type routeTransport map[string]*url.URL
+
+func (t routeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target, ok := t[req.URL.Host]
+	if ok {
+		req.URL.Scheme = target.Scheme
+		req.URL.Host = target.Host
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// route adds the route from the endpoint of the given env to the given server URL.
+func (t routeTransport) route(tb testing.TB, env Env, server string) {
+	from, err := url.Parse(env.Endpoint())
+	if err != nil {
+		tb.Fatalf("can't parse env endpoint: %v", err)
+	}
+	to, err := url.Parse(server)
+	if err != nil {
+		tb.Fatalf("can't parse test server url: %v", err)
+	}
+	t[from.Host] = to
+}
+
+// failTransport type implements http.RoundTripper, which fails requests to the endpoint of the given env
+// like a network failure and passes other requests to the next transport.
+type failTransport struct {
+	env  Env
+	err  error
+	next http.RoundTripper
+}
+
+func (t failTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if endpoint, err := url.Parse(t.env.Endpoint()); err == nil && req.URL.Host == endpoint.Host {
+		return nil, t.err
+	}
+	return t.next.RoundTrip(req)
+}
+
+func TestNewTestServer(t *testing.T) {
+	server, env := NewTestServer(map[string]ValidationResponse{
+		"valid":   {Status: 0, Environment: Sandbox, LatestReceipt: "latest"},
+		"expired": {Status: 21006},
+	})
+	defer server.Close()
+
+	type args struct {
+		receipt string
+	}
+	type test struct {
+		args args
+		want int
+	}
+
+	tests := map[string]test{
+		"Valid":   {args{receipt: "valid"}, 0},
+		"Expired": {args{receipt: "expired"}, 21006},
+		"Unknown": {args{receipt: "unknown"}, 21002},
+	}
+
+	v := NewValidator()
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			resp, err := v.Validate(context.Background(), tc.args.receipt, env)
+			if err != nil {
+				t.Fatalf("Validator.Validate() error = %v", err)
+			}
+			if resp.Status != tc.want {
+				t.Errorf("Validator.Validate() status = %v, want %v", resp.Status, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewTestServer_ValidateAutoFallback(t *testing.T) {
+	production, _ := NewTestServer(map[string]ValidationResponse{"receipt": {Status: 21007}})
+	defer production.Close()
+	sandbox, _ := NewTestServer(map[string]ValidationResponse{"receipt": {Status: 0, Environment: Sandbox}})
+	defer sandbox.Close()
+
+	transport := routeTransport{}
+	transport.route(t, Production, production.URL)
+	transport.route(t, Sandbox, sandbox.URL)
+
+	v := NewValidator(WithHTTPClient(&http.Client{Transport: transport}))
+	resp, err := v.ValidateAuto(context.Background(), "receipt")
+	if err != nil {
+		t.Fatalf("Validator.ValidateAuto() error = %v", err)
+	}
+	if resp.Status != 0 || resp.Environment != Sandbox {
+		t.Errorf("Validator.ValidateAuto() = status %v in %v, want status 0 in %v", resp.Status, resp.Environment, Sandbox)
+	}
+}
+
+func TestNewTestServer_ValidateAutoSandboxFirst(t *testing.T) {
+	production, _ := NewTestServer(map[string]ValidationResponse{"receipt": {Status: 0, Environment: Production}})
+	defer production.Close()
+
+	var sandboxRequests int
+	sandbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sandboxRequests++
+		fmt.Fprint(w, `{"status":21008}`)
+	}))
+	defer sandbox.Close()
+
+	transport := routeTransport{}
+	transport.route(t, Production, production.URL)
+	transport.route(t, Sandbox, sandbox.URL)
+
+	v := NewValidator(WithAutoStrategy(SandboxFirst), WithHTTPClient(&http.Client{Transport: transport}))
+	resp, err := v.ValidateAuto(context.Background(), "receipt")
+	if err != nil {
+		t.Fatalf("Validator.ValidateAuto() error = %v", err)
+	}
+	if resp.Status != 0 || resp.Environment != Production || sandboxRequests != 1 {
+		t.Errorf("Validator.ValidateAuto() = status %v in %v after %v sandbox requests, want status 0 in %v after 1",
+			resp.Status, resp.Environment, sandboxRequests, Production)
+	}
+
+	// The default env of ValidateDefault doesn't change the order of ValidateAuto.
+	sandboxRequests = 0
+	v = NewValidator(WithDefaultEnv(Sandbox), WithHTTPClient(&http.Client{Transport: transport}))
+	if _, err := v.ValidateAuto(context.Background(), "receipt"); err != nil {
+		t.Fatalf("Validator.ValidateAuto() error = %v", err)
+	}
+	if sandboxRequests != 0 {
+		t.Errorf("Validator.ValidateAuto() made %v sandbox requests with sandbox default env, want 0", sandboxRequests)
+	}
+}
+
+func TestWithAutoStrategy(t *testing.T) {
+	type test struct {
+		strategy AutoStrategy
+		wantErr  bool
+	}
+
+	tests := map[string]test{
+		"ProductionFirst": {ProductionFirst, false},
+		"SandboxFirst":    {SandboxFirst, false},
+		"Unknown":         {AutoStrategy(42), true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			v := NewValidator(WithAutoStrategy(tc.strategy))
+			if err := v.Err(); (err != nil) != tc.wantErr {
+				t.Errorf("Validator.Err() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewTestServer_ValidateAutoRetryFailure(t *testing.T) {
+	production, _ := NewTestServer(map[string]ValidationResponse{"receipt": {Status: 21007}})
+	defer production.Close()
+	sandbox, _ := NewTestServer(nil)
+	sandbox.Close()
+
+	transport := routeTransport{}
+	transport.route(t, Production, production.URL)
+	transport.route(t, Sandbox, sandbox.URL)
+
+	v := NewValidator(WithHTTPClient(&http.Client{Transport: transport}))
+	resp, err := v.ValidateAuto(context.Background(), "receipt")
+	if err == nil {
+		t.Fatalf("Validator.ValidateAuto() = %v, want error of the sandbox retry", resp)
+	}
+	if msg := err.Error(); strings.Contains(msg, "<nil>") || !strings.Contains(msg, "http request failure") {
+		t.Errorf("Validator.ValidateAuto() error = %v, want the error of the sandbox retry", err)
+	}
+}
+
+func TestNewTestServer_ValidateAutoProductionOnSandbox(t *testing.T) {
+	var productionRequests int
+	production := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		productionRequests++
+		fmt.Fprint(w, `{"status":21008}`)
+	}))
+	defer production.Close()
+	sandbox, _ := NewTestServer(map[string]ValidationResponse{"receipt": {Status: 0, Environment: Sandbox}})
+	defer sandbox.Close()
+
+	transport := routeTransport{}
+	transport.route(t, Production, production.URL)
+	transport.route(t, Sandbox, sandbox.URL)
+
+	// The production receipt can't be valid in the sandbox, so 21008 from production isn't retried there.
+	v := NewValidator(WithHTTPClient(&http.Client{Transport: transport}))
+	resp, err := v.ValidateAuto(context.Background(), "receipt")
+	if err != nil {
+		t.Fatalf("Validator.ValidateAuto() error = %v", err)
+	}
+	if resp.Status != 21008 || productionRequests != 1 {
+		t.Errorf("Validator.ValidateAuto() = status %v after %v production requests, want 21008 after 1", resp.Status, productionRequests)
+	}
+}
+
+func TestValidator_ValidateAuto_AutoValidationError(t *testing.T) {
+	errNetwork := errors.New("network is unreachable")
+
+	type args struct {
+		strategy AutoStrategy
+		firstEnv AppleEnv
+		status   int
+	}
+	type test struct {
+		args    args
+		wantEnv AppleEnv
+	}
+
+	tests := map[string]test{
+		"ProductionFirst": {args{ProductionFirst, Production, 21007}, Sandbox},
+		"SandboxFirst":    {args{SandboxFirst, Sandbox, 21008}, Production},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			first, _ := NewTestServer(map[string]ValidationResponse{"receipt": {Status: tc.args.status}})
+			defer first.Close()
+
+			transport := routeTransport{}
+			transport.route(t, tc.args.firstEnv, first.URL)
+
+			v := NewValidator(
+				WithAutoStrategy(tc.args.strategy),
+				WithHTTPClient(&http.Client{Transport: failTransport{env: tc.wantEnv, err: errNetwork, next: transport}}),
+			)
+			resp, err := v.ValidateAuto(context.Background(), "receipt")
+			if err == nil {
+				t.Fatalf("Validator.ValidateAuto() = %v, want error of the retry", resp)
+			}
+
+			var autoErr *AutoValidationError
+			if !errors.As(err, &autoErr) {
+				t.Fatalf("Validator.ValidateAuto() error = %T, want *AutoValidationError", err)
+			}
+			if autoErr.Env != tc.wantEnv || autoErr.Status != tc.args.status {
+				t.Errorf("AutoValidationError = retry in %v after status %d, want retry in %v after status %d",
+					autoErr.Env, autoErr.Status, tc.wantEnv, tc.args.status)
+			}
+			if !errors.Is(err, errNetwork) {
+				t.Errorf("Validator.ValidateAuto() error = %v, want to match the network error", err)
+			}
+			var urlErr *url.Error
+			if !errors.As(err, &urlErr) {
+				t.Errorf("Validator.ValidateAuto() error = %v, want to unwrap to *url.Error", err)
+			}
+			if msg := err.Error(); strings.Contains(msg, "<nil>") || !strings.Contains(msg, tc.wantEnv.String()) {
+				t.Errorf("Validator.ValidateAuto() error = %v, want the failed env %v in the message", err, tc.wantEnv)
+			}
+		})
+	}
+}
+
+func TestValidator_ValidateAuto_FirstAttemptError(t *testing.T) {
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+
+	transport := routeTransport{}
+	transport.route(t, Production, unavailable.URL)
+	transport.route(t, Sandbox, unavailable.URL)
+	client := &http.Client{Transport: transport}
+
+	type test struct {
+		opts []ValidatorOption
+	}
+
+	tests := map[string]test{
+		"ProductionFirst": {[]ValidatorOption{WithHTTPClient(client)}},
+		"SandboxFirst":    {[]ValidatorOption{WithHTTPClient(client), WithAutoStrategy(SandboxFirst)}},
+		"CustomEnv":       {[]ValidatorOption{WithHTTPClient(client), WithDefaultEnv(Endpoint(unavailable.URL))}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewValidator(tc.opts...).ValidateAuto(context.Background(), "receipt")
+			if !errors.Is(err, ErrUnexpectedHTTPStatus) {
+				t.Fatalf("Validator.ValidateAuto() error = %v, want %v", err, ErrUnexpectedHTTPStatus)
+			}
+			var statusErr *HTTPStatusError
+			if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+				t.Errorf("Validator.ValidateAuto() error = %v, want *HTTPStatusError with status %v", err, http.StatusServiceUnavailable)
+			}
+			var autoErr *AutoValidationError
+			if errors.As(err, &autoErr) {
+				t.Errorf("Validator.ValidateAuto() error = %v, want the first attempt error", err)
+			}
+		})
+	}
+
+	t.Run("Canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := NewValidator(WithHTTPClient(client)).ValidateAuto(ctx, "receipt"); !errors.Is(err, context.Canceled) {
+			t.Errorf("Validator.ValidateAuto() error = %v, want %v", err, context.Canceled)
+		}
+	})
+}
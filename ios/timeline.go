@@ -0,0 +1,112 @@
+package ios
+
+import (
+	"sort"
+	"time"
+)
+
+// StatusChange type represents the change of subscription status at the moment of the transaction.
+type StatusChange struct {
+	At        time.Time
+	Status    SubscriptionStatus
+	ProductID string
+}
+
+// StatusTimeline return the chronologically ordered changes of subscription status.
+// The status of each transaction is computed the same way as by InApp.Status method, but at the purchase date
+// of the transaction, which also dates the change, so renewed transactions don't look expired.
+// Consecutive transactions of the same product with the same status produce a single change.
+// If the latest transaction of a product has expired by now without cancellation,
+// the timeline of the product ends with Expired change at its expiration date.
+func (i InApps) StatusTimeline() []StatusChange {
+	sorted := append(InApps(nil), i...).Sorted(ByPurchaseDate)
+
+	var timeline []StatusChange
+	last := make(map[string]SubscriptionStatus)
+	latest := make(map[string]InApp)
+	var products []string
+	for n := len(sorted) - 1; n >= 0; n-- {
+		inapp := sorted[n]
+		if _, ok := latest[inapp.ProductID]; !ok {
+			products = append(products, inapp.ProductID)
+		}
+		latest[inapp.ProductID] = inapp
+
+		status := inapp.statusAt(convertToTime(inapp.PurchaseDateMS))
+		if previous, ok := last[inapp.ProductID]; ok && previous == status {
+			continue
+		}
+		last[inapp.ProductID] = status
+		timeline = append(timeline, StatusChange{
+			At:        convertToTime(inapp.PurchaseDateMS),
+			Status:    status,
+			ProductID: inapp.ProductID,
+		})
+	}
+
+	for _, productID := range products {
+		inapp := latest[productID]
+		if last[productID] == Canceled || inapp.Status() != Expired {
+			continue
+		}
+		timeline = append(timeline, StatusChange{
+			At:        convertToTime(inapp.ExpiresDateMS),
+			Status:    Expired,
+			ProductID: productID,
+		})
+	}
+	sort.SliceStable(timeline, func(a, b int) bool {
+		return timeline[a].At.Before(timeline[b].At)
+	})
+	return timeline
+}
+
+// BillingPeriod type represents the continuous span of a subscription with the same trial and refund state.
+type BillingPeriod struct {
+	Start time.Time
+	End   time.Time
+	Trial bool
+	// Refunded periods end at the cancellation date.
+	Refunded bool
+	// AfterLapse is true if the subscription wasn't active between the previous period and this one.
+	AfterLapse bool
+}
+
+// BillingPeriods return the chronologically ordered billing periods of the given product.
+// Renewals, which start when the previous transaction expires, are merged into a single period
+// unless the trial or refund state changes. A gap between transactions is a lapse,
+// so the next transaction starts a new period. Transactions without expiration date are skipped.
+func (i InApps) BillingPeriods(productID string) []BillingPeriod {
+	inapps := i.filter(func(inapp InApp) bool {
+		return inapp.ProductID == productID && inapp.ExpiresDateMS > 0
+	})
+	sort.SliceStable(inapps, func(a, b int) bool {
+		return inapps[a].PurchaseDateMS < inapps[b].PurchaseDateMS
+	})
+
+	var periods []BillingPeriod
+	for _, inapp := range inapps {
+		period := BillingPeriod{
+			Start:    convertToTime(inapp.PurchaseDateMS),
+			End:      convertToTime(inapp.ExpiresDateMS),
+			Trial:    inapp.IsTrialPeriod,
+			Refunded: inapp.Refunded(),
+		}
+		if period.Refunded && inapp.CancellationDateMS > 0 {
+			period.End = convertToTime(inapp.CancellationDateMS)
+		}
+
+		if len(periods) > 0 {
+			last := &periods[len(periods)-1]
+			period.AfterLapse = period.Start.After(last.End)
+			if !period.AfterLapse && !period.Refunded && !last.Refunded && period.Trial == last.Trial {
+				if period.End.After(last.End) {
+					last.End = period.End
+				}
+				continue
+			}
+		}
+		periods = append(periods, period)
+	}
+	return periods
+}
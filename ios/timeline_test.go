@@ -0,0 +1,111 @@
+package ios
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInApps_StatusTimeline(t *testing.T) {
+	day := 24 * time.Hour
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(days int) time.Time { return start.Add(time.Duration(days) * day) }
+
+	now := at(60)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	type test struct {
+		inapps InApps
+		want   []StatusChange
+	}
+
+	tests := map[string]test{
+		"TrialPaidCanceled": {
+			InApps{
+				{ProductID: "monthly", PurchaseDateMS: timeMS(at(37)), ExpiresDateMS: timeMS(at(67)), CancellationDateMS: timeMS(at(50))},
+				{ProductID: "monthly", PurchaseDateMS: timeMS(at(0)), ExpiresDateMS: timeMS(at(7)), IsTrialPeriod: true},
+				{ProductID: "monthly", PurchaseDateMS: timeMS(at(7)), ExpiresDateMS: timeMS(at(37))},
+			},
+			[]StatusChange{
+				{At: at(0), Status: Trial, ProductID: "monthly"},
+				{At: at(7), Status: Paid, ProductID: "monthly"},
+				{At: at(37), Status: Canceled, ProductID: "monthly"},
+			},
+		},
+		"Renewals": {
+			InApps{
+				{ProductID: "monthly", PurchaseDateMS: timeMS(at(0)), ExpiresDateMS: timeMS(at(30))},
+				{ProductID: "monthly", PurchaseDateMS: timeMS(at(30)), ExpiresDateMS: timeMS(at(60))},
+				{ProductID: "monthly", PurchaseDateMS: timeMS(at(60)), ExpiresDateMS: timeMS(at(90))},
+			},
+			[]StatusChange{
+				{At: at(0), Status: Paid, ProductID: "monthly"},
+			},
+		},
+		"Lapsed": {
+			InApps{
+				{ProductID: "weekly", PurchaseDateMS: timeMS(at(0)), ExpiresDateMS: timeMS(at(7)), IsTrialPeriod: true},
+				{ProductID: "weekly", PurchaseDateMS: timeMS(at(7)), ExpiresDateMS: timeMS(at(14))},
+			},
+			[]StatusChange{
+				{At: at(0), Status: Trial, ProductID: "weekly"},
+				{At: at(7), Status: Paid, ProductID: "weekly"},
+				{At: at(14), Status: Expired, ProductID: "weekly"},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			first := tc.inapps[0]
+
+			got := tc.inapps.StatusTimeline()
+			if len(got) != len(tc.want) {
+				t.Fatalf("InApps.StatusTimeline() = %v, want %v", got, tc.want)
+			}
+			for n := range tc.want {
+				if !got[n].At.Equal(tc.want[n].At) || got[n].Status != tc.want[n].Status || got[n].ProductID != tc.want[n].ProductID {
+					t.Errorf("InApps.StatusTimeline()[%d] = %+v, want %+v", n, got[n], tc.want[n])
+				}
+			}
+			if tc.inapps[0].PurchaseDateMS != first.PurchaseDateMS {
+				t.Errorf("InApps.StatusTimeline() should not change the order of elements")
+			}
+		})
+	}
+}
+
+func TestInApps_BillingPeriods(t *testing.T) {
+	day := 24 * time.Hour
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(days int) time.Time { return start.Add(time.Duration(days) * day) }
+
+	inapps := InApps{
+		{ProductID: "monthly", TransactionID: "1", PurchaseDateMS: timeMS(at(0)), ExpiresDateMS: timeMS(at(7)), IsTrialPeriod: true},
+		{ProductID: "monthly", TransactionID: "2", PurchaseDateMS: timeMS(at(7)), ExpiresDateMS: timeMS(at(37))},
+		{ProductID: "monthly", TransactionID: "3", PurchaseDateMS: timeMS(at(37)), ExpiresDateMS: timeMS(at(67))},
+		{ProductID: "monthly", TransactionID: "4", PurchaseDateMS: timeMS(at(90)), ExpiresDateMS: timeMS(at(120))},
+		{ProductID: "monthly", TransactionID: "5", PurchaseDateMS: timeMS(at(120)), ExpiresDateMS: timeMS(at(150)),
+			CancellationDateMS: timeMS(at(125)), CancellationReason: "1"},
+		{ProductID: "yearly", TransactionID: "6", PurchaseDateMS: timeMS(at(0)), ExpiresDateMS: timeMS(at(365))},
+		{ProductID: "monthly", TransactionID: "7", PurchaseDateMS: timeMS(at(1))},
+	}
+
+	want := []BillingPeriod{
+		{Start: at(0), End: at(7), Trial: true},
+		{Start: at(7), End: at(67)},
+		{Start: at(90), End: at(120), AfterLapse: true},
+		{Start: at(120), End: at(125), Refunded: true},
+	}
+
+	got := inapps.BillingPeriods("monthly")
+	if len(got) != len(want) {
+		t.Fatalf("InApps.BillingPeriods() = %+v, want %+v", got, want)
+	}
+	for n := range want {
+		if !got[n].Start.Equal(want[n].Start) || !got[n].End.Equal(want[n].End) ||
+			got[n].Trial != want[n].Trial || got[n].Refunded != want[n].Refunded || got[n].AfterLapse != want[n].AfterLapse {
+			t.Errorf("InApps.BillingPeriods()[%d] = %+v, want %+v", n, got[n], want[n])
+		}
+	}
+}
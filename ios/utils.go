@@ -1,8 +1,56 @@
 package ios
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
-// convertToTime convert unix timestamp in milliseconds to Go time.Time
+// appleDateLayout is the layout of date and time part of human-readable Apple date fields,
+// which look like "2013-08-01 07:00:00 Etc/GMT" or "2013-08-01 00:00:00 America/Los_Angeles".
+const appleDateLayout = "2006-01-02 15:04:05"
+
+// timeNow returns the current time. It's a variable so tests can freeze the clock.
+var timeNow = time.Now
+
+// The range of plausible timestamps in milliseconds: from 2008, when the App Store was launched,
+// till 2100. Timestamps out of the range are malformed and would overflow time.Unix for large values.
+const (
+	minTimeMS int64 = 1199145600000 // 2008-01-01 00:00:00 UTC
+	maxTimeMS int64 = 4102444800000 // 2100-01-01 00:00:00 UTC
+)
+
+// convertToTime convert unix timestamp in milliseconds to Go time.Time in UTC,
+// so the result doesn't depend on the time zone of the server.
+// Implausible timestamps, including zero, are converted to the zero time.Time.
 func convertToTime(timeMS int64) time.Time {
-	return time.Unix(0, timeMS*int64(time.Millisecond))
+	if timeMS < minTimeMS || timeMS > maxTimeMS {
+		return time.Time{}
+	}
+	return time.Unix(0, timeMS*int64(time.Millisecond)).UTC()
+}
+
+// parseAppleDate parse human-readable Apple date string to Go time.Time.
+// The trailing time zone is an IANA name. Etc/GMT is handled without loading
+// the time zone database, because it's the most common one.
+func parseAppleDate(date string) (time.Time, error) {
+	fields := strings.Fields(date)
+	if len(fields) != 3 {
+		return time.Time{}, fmt.Errorf("can't parse date %q: unexpected format", date)
+	}
+
+	location := time.UTC
+	if zone := fields[2]; zone != "Etc/GMT" {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("can't parse date %q: %v", date, err)
+		}
+		location = loc
+	}
+
+	t, err := time.ParseInLocation(appleDateLayout, fields[0]+" "+fields[1], location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("can't parse date %q: %v", date, err)
+	}
+	return t, nil
 }
@@ -0,0 +1,74 @@
+package ios
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestConvertToTime(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("UTC+9", 9*60*60)
+	defer func() { time.Local = local }()
+
+	got := convertToTime(1527811200000)
+	if got.Location() != time.UTC {
+		t.Errorf("convertToTime().Location() = %v, want %v", got.Location(), time.UTC)
+	}
+	if s, want := got.Format(appleDateLayout), "2018-06-01 00:00:00"; s != want {
+		t.Errorf("convertToTime().Format() = %v, want %v", s, want)
+	}
+
+	inapps := InApps{
+		{TransactionID: "1", PurchaseDateMS: 1527811200000, ExpiresDateMS: 1530403200000},
+		{TransactionID: "2", PurchaseDateMS: 1530403200000, ExpiresDateMS: timeMS(time.Now().Add(time.Hour))},
+	}
+	if !inapps[0].Expired() || inapps[1].Expired() {
+		t.Errorf("InApp.Expired() = (%v, %v), want (true, false)", inapps[0].Expired(), inapps[1].Expired())
+	}
+	if latest := inapps.LatestInApp(); latest.TransactionID != "2" {
+		t.Errorf("InApps.LatestInApp().TransactionID = %v, want 2", latest.TransactionID)
+	}
+}
+
+func TestConvertToTime_Implausible(t *testing.T) {
+	type args struct {
+		timeMS int64
+	}
+	type test struct {
+		args args
+		want time.Time
+	}
+
+	tests := map[string]test{
+		"Negative":    {args{timeMS: -1527811200000}, time.Time{}},
+		"Zero":        {args{timeMS: 0}, time.Time{}},
+		"BeforeStore": {args{timeMS: 1000}, time.Time{}},
+		"Overflow":    {args{timeMS: math.MaxInt64}, time.Time{}},
+		"FarFuture":   {args{timeMS: 32503680000000}, time.Time{}},
+		"Plausible":   {args{timeMS: 1527811200000}, time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := convertToTime(tc.args.timeMS); !got.Equal(tc.want) {
+				t.Errorf("convertToTime() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("Sorted", func(t *testing.T) {
+		inapps := InApps{
+			{TransactionID: "overflow", PurchaseDateMS: math.MaxInt64},
+			{TransactionID: "old", PurchaseDateMS: 1527811200000},
+			{TransactionID: "negative", PurchaseDateMS: -1},
+			{TransactionID: "new", PurchaseDateMS: 1527811300000},
+			{TransactionID: "zero"},
+		}
+
+		got := inapps.Sorted(ByPurchaseDate)
+		if got[0].TransactionID != "new" || got[1].TransactionID != "old" {
+			t.Errorf("InApps.Sorted() = %v, want plausible purchases first", got)
+		}
+	})
+}
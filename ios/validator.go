@@ -6,20 +6,52 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// Version is the version of the library. It's sent in User-Agent header of requests to the App Store,
+// so the traffic of the library could be told apart when debugging with Apple support.
+const Version = "0.1.0"
+
+// defaultUserAgent is the value of User-Agent header if WithUserAgent option isn't used.
+const defaultUserAgent = "goinapp/" + Version
+
 // Validator type represent http client for validation in-app purchases.
 type Validator struct {
-	client   *http.Client
-	password string
+	client     *http.Client
+	password   string
+	env        Env
+	processors []ResponseProcessor
+	decode     func(io.Reader, interface{}) error
+	retries    int
+	backoff    func(attempt int) time.Duration
+	allowEmpty bool
+	debug      *responseRing
+	err        error
+	sleep      func(ctx context.Context, d time.Duration) error
+	inflight   chan struct{}
+	signer     BodySigner
+	language   string
+	normalize  bool
+	userAgent  string
+	strategy   AutoStrategy
+	recorder   *recorder
 }
 
 // NewValidator return a new instance of Validator type.
 func NewValidator(opts ...ValidatorOption) *Validator {
 	validator := &Validator{
-		password: "",
+		password:  "",
+		env:       Production,
+		userAgent: defaultUserAgent,
 		client: &http.Client{
 			Timeout: 10 * time.Second,
 		},
@@ -29,9 +61,34 @@ func NewValidator(opts ...ValidatorOption) *Validator {
 		opt(validator)
 	}
 
+	// The recorder wraps the transport after all options are applied,
+	// so it doesn't depend on the order of WithRecorder, WithHTTPClient and WithProxy options.
+	if r := validator.recorder; r != nil {
+		r.next = validator.client.Transport
+		if r.next == nil {
+			r.next = http.DefaultTransport
+		}
+		client := *validator.client
+		client.Transport = r
+		validator.client = &client
+	}
+
 	return validator
 }
 
+// Err returns the error of the first invalid option passed to NewValidator.
+// Validate fails with the same error, so it's enough to check it once after construction.
+func (v *Validator) Err() error {
+	return v.err
+}
+
+// setErr remembers the error of the option, only the first error is kept.
+func (v *Validator) setErr(err error) {
+	if v.err == nil {
+		v.err = err
+	}
+}
+
 // ValidatorOption represents optional function, which could be passed to NewValidator() func to change the
 // default properties of returned Validator type.
 type ValidatorOption func(*Validator)
@@ -52,20 +109,358 @@ func WithPassword(password string) func(*Validator) {
 	}
 }
 
+// WithProxy represents the optional function, which returns ValidatorOption function type.
+// Receives the proxy URL with http, https or socks5 scheme, which will be set to the transport
+// of Validator client. The client is copied, so the http.Client passed to WithHTTPClient isn't changed.
+// Invalid URL is reported by Validator Err method.
+func WithProxy(proxyURL string) func(*Validator) {
+	return func(v *Validator) {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			v.setErr(fmt.Errorf("invalid proxy url: %v", err))
+			return
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			v.setErr(fmt.Errorf("invalid proxy url: unsupported scheme %q", u.Scheme))
+			return
+		}
+		if u.Host == "" {
+			v.setErr(fmt.Errorf("invalid proxy url: missing host"))
+			return
+		}
+
+		var transport *http.Transport
+		switch base := v.client.Transport.(type) {
+		case nil:
+			transport = http.DefaultTransport.(*http.Transport).Clone()
+		case *http.Transport:
+			transport = base.Clone()
+		default:
+			v.setErr(fmt.Errorf("proxy can't be set for %T transport", base))
+			return
+		}
+		transport.Proxy = http.ProxyURL(u)
+
+		client := *v.client
+		client.Transport = transport
+		v.client = &client
+	}
+}
+
+// languageTag matches well-formed BCP 47 language tags: the language subtag followed by
+// optional script, region, variant, extension and private use subtags, like "en", "en-US" or "zh-Hant-TW".
+var languageTag = regexp.MustCompile(`^(?i)[a-z]{2,8}(-[a-z]{4})?(-([a-z]{2}|[0-9]{3}))?(-([a-z0-9]{5,8}|[0-9][a-z0-9]{3}))*(-[0-9a-wyz](-[a-z0-9]{2,8})+)*(-x(-[a-z0-9]{1,8})+)?$`)
+
+// WithAcceptLanguage represents the optional function, which returns ValidatorOption function type.
+// Receives the BCP 47 language tag, which will be sent in Accept-Language header of each request.
+// Malformed tag is reported by Validator Err method.
+func WithAcceptLanguage(tag string) func(*Validator) {
+	return func(v *Validator) {
+		if !languageTag.MatchString(tag) {
+			v.setErr(fmt.Errorf("invalid language tag %q", tag))
+			return
+		}
+		v.language = tag
+	}
+}
+
+// WithUserAgent represents the optional function, which returns ValidatorOption function type.
+// Receives the string, which will be sent in User-Agent header instead of the default "goinapp/<Version>".
+// Empty string keeps the default.
+func WithUserAgent(userAgent string) func(*Validator) {
+	return func(v *Validator) {
+		if userAgent != "" {
+			v.userAgent = userAgent
+		}
+	}
+}
+
+// WithRecorder represents the optional function, which returns ValidatorOption function type.
+// Receives the directory, where the interactions with the App Store are recorded, to make tests hermetic,
+// and the RecorderMode. A request, which was recorded before, is replayed from the directory without
+// hitting the network. A missing one is sent and recorded in RecordMissing mode and fails with
+// ErrNotRecorded in ReplayOnly mode. Recordings are keyed by the endpoint and the receipt hash,
+// the password is redacted in them.
+//
+// The recorder wraps the transport of the client set by WithHTTPClient and WithProxy options regardless
+// of the order of options. The client is copied like in WithProxy option.
+func WithRecorder(dir string, mode RecorderMode) func(*Validator) {
+	return func(v *Validator) {
+		if dir == "" {
+			v.setErr(fmt.Errorf("recorder directory is empty"))
+			return
+		}
+		switch mode {
+		case RecordMissing, ReplayOnly:
+		default:
+			v.setErr(fmt.Errorf("invalid recorder mode %d", mode))
+			return
+		}
+		v.recorder = &recorder{dir: dir, mode: mode}
+	}
+}
+
+// WithMaxConcurrent represents the optional function, which returns ValidatorOption function type.
+// Receives the maximum number of simultaneous validations. When the limit is reached,
+// Validate blocks until one of the validations finishes or the context is done.
+// Zero or negative value means no limit, which is the default.
+func WithMaxConcurrent(n int) func(*Validator) {
+	return func(v *Validator) {
+		if n <= 0 {
+			v.inflight = nil
+			return
+		}
+		v.inflight = make(chan struct{}, n)
+	}
+}
+
+// WithDefaultEnv represents the optional function, which returns ValidatorOption function type.
+// Receives the Env, which will be used by ValidateDefault method. The default is Production.
+func WithDefaultEnv(env Env) func(*Validator) {
+	return func(v *Validator) {
+		v.env = env
+	}
+}
+
+// AutoStrategy represents the order, in which ValidateAuto tries Apple environments.
+type AutoStrategy int
+
+const (
+	// ProductionFirst validates the receipt against the production environment and falls back to the sandbox one.
+	// It's the default strategy.
+	ProductionFirst AutoStrategy = iota
+	// SandboxFirst validates the receipt against the sandbox environment and falls back to the production one.
+	SandboxFirst
+)
+
+// WithAutoStrategy represents the optional function, which returns ValidatorOption function type.
+// Receives the AutoStrategy, which will be used by ValidateAuto method. The default is ProductionFirst.
+// Unknown strategy is reported by Validator Err method.
+func WithAutoStrategy(strategy AutoStrategy) func(*Validator) {
+	return func(v *Validator) {
+		switch strategy {
+		case ProductionFirst, SandboxFirst:
+			v.strategy = strategy
+		default:
+			v.setErr(fmt.Errorf("invalid auto strategy %d", strategy))
+		}
+	}
+}
+
+// ResponseProcessor represents the function, which is invoked by Validate after successful decoding of the response.
+// It's able to change the response or reject it by returning an error.
+type ResponseProcessor func(ctx context.Context, resp *ValidationResponse) error
+
+// WithResponseProcessor represents the optional function, which returns ValidatorOption function type.
+// Receives the ResponseProcessor, which will be appended to Validator processors.
+// Processors are invoked in the order of registration and the first error aborts the validation.
+func WithResponseProcessor(p ResponseProcessor) func(*Validator) {
+	return func(v *Validator) {
+		v.processors = append(v.processors, p)
+	}
+}
+
+// BodySigner represents the function, which is invoked by Validate with the final request body.
+// It returns the name and the value of the header, which will be set to the request,
+// so a proxy in front of the App Store could authenticate the caller.
+type BodySigner func(body []byte) (headerName, headerValue string, err error)
+
+// WithBodySigner represents the optional function, which returns ValidatorOption function type.
+// Receives the BodySigner, which will sign every outgoing request body.
+func WithBodySigner(signer BodySigner) func(*Validator) {
+	return func(v *Validator) {
+		v.signer = signer
+	}
+}
+
+// WithDecoder represents the optional function, which returns ValidatorOption function type.
+// Receives the function, which will be used to decode the response body instead of the
+// encoding/json decoder. It allows to plug in a faster JSON implementation.
+func WithDecoder(decode func(r io.Reader, v interface{}) error) func(*Validator) {
+	return func(v *Validator) {
+		v.decode = decode
+	}
+}
+
+// WithMaxRetries represents the optional function, which returns ValidatorOption function type.
+// Receives the maximum number of retries, which ValidateWithRetry and ValidateAuto make
+// for responses marked as retryable by Apple. The default is 0, which means no retries.
+// It's the same as WithRetry(n+1, nil), negative n means no retries.
+//
+// Deprecated: use WithRetry, which also configures the backoff.
+func WithMaxRetries(n int) func(*Validator) {
+	if n < 0 {
+		n = 0
+	}
+	return WithRetry(n+1, nil)
+}
+
+// WithRetry represents the optional function, which returns ValidatorOption function type.
+// Receives the maximum number of attempts, including the first one, which ValidateWithRetry and ValidateAuto make,
+// and the backoff function, which returns the delay before the given retry, starting from 1.
+// A nil backoff retries without delay.
+// The number of attempts less than 1 is reported by Validator Err method.
+func WithRetry(maxAttempts int, backoff func(attempt int) time.Duration) func(*Validator) {
+	return func(v *Validator) {
+		if maxAttempts < 1 {
+			v.setErr(fmt.Errorf("invalid number of attempts %d", maxAttempts))
+			return
+		}
+		v.retries = maxAttempts - 1
+		v.backoff = backoff
+	}
+}
+
+// WithAllowEmptyReceipt represents the optional function, which returns ValidatorOption function type.
+// By default Validate rejects empty receipt with ErrMalformedReceiptData without sending the request.
+// Receives the bool, which allows sending empty receipts for custom endpoints which accept them.
+func WithAllowEmptyReceipt(allow bool) func(*Validator) {
+	return func(v *Validator) {
+		v.allowEmpty = allow
+	}
+}
+
+// WithReceiptNormalization represents the optional function, which returns ValidatorOption function type.
+// Receives the flag which enables receipt normalization before validation: URL-safe base64 receipts,
+// which are sent by some cross-platform StoreKit plugins, are converted to the standard base64 with padding,
+// since the App Store rejects them. Normalization is off by default.
+func WithReceiptNormalization(enabled bool) func(*Validator) {
+	return func(v *Validator) {
+		v.normalize = enabled
+	}
+}
+
+// normalizeReceipt converts the URL-safe base64 receipt to the standard base64 with padding.
+func normalizeReceipt(receipt string) string {
+	receipt = strings.TrimSpace(receipt)
+	if !strings.ContainsAny(receipt, "-_") && len(receipt)%4 == 0 {
+		return receipt
+	}
+	receipt = strings.NewReplacer("-", "+", "_", "/").Replace(strings.TrimRight(receipt, "="))
+	if n := len(receipt) % 4; n != 0 {
+		receipt += strings.Repeat("=", 4-n)
+	}
+	return receipt
+}
+
+// WithDebugCapture represents the optional function, which returns ValidatorOption function type.
+// Receives the number of the last raw response bodies, which will be kept by Validator
+// for diagnostic purposes and available via LastResponses method. Capturing is off by default.
+// The submitted receipt and the password are redacted in the captured bodies.
+func WithDebugCapture(n int) func(*Validator) {
+	return func(v *Validator) {
+		if n <= 0 {
+			v.debug = nil
+			return
+		}
+		v.debug = newResponseRing(n)
+	}
+}
+
+// LastResponses returns the last raw response bodies from the oldest to the newest,
+// or nil if capturing is not enabled by WithDebugCapture option.
+func (v *Validator) LastResponses() [][]byte {
+	if v.debug == nil {
+		return nil
+	}
+	return v.debug.list()
+}
+
+// Close closes the idle connections of the Validator http client, so they don't outlive
+// the Validator on server shutdown. In-flight validations are not interrupted.
+// It's safe to call Close more than once. Copies made by WithPasswordCopy share the connections.
+func (v *Validator) Close() {
+	v.client.CloseIdleConnections()
+}
+
+// WithPasswordCopy returns a shallow copy of the Validator with the given password.
+// The copy shares the http client with the original, so one tuned transport could serve
+// many applications with different shared secrets. The original Validator stays unchanged.
+func (v *Validator) WithPasswordCopy(password string) *Validator {
+	c := *v
+	c.password = password
+	return &c
+}
+
 // Validate sends http POST with JSON body, which is represented by ValidationRequest struct to AppStore backend
 // and parse the response with JSON body to ValidationResponse struct.
 //
 // The receipt must be a valid base64 encoded string from your StoreKit.
+// Empty receipt is rejected with ErrMalformedReceiptData unless WithAllowEmptyReceipt option is used.
 //
 // The env must implement the Env interface.
 // You can use AppleEnv type, which is represented by two constants: Production and Sandbox.
+// If the env implements ContextEnv interface, the endpoint is resolved for the given context.
 //
 // You also can implement Env interface to send receipt to your custom endpoint. In that
 // case the custom endpoint should take care about in-app purchases validation and returning the valid response.
+//
+// Returned errors never contain the receipt or the password, the receipt is replaced
+// with the token returned by RedactReceipt, so the errors are safe to log.
 func (v *Validator) Validate(ctx context.Context, receipt string, env Env) (*ValidationResponse, error) {
+	resp, _, err := v.ValidateAt(ctx, receipt, env)
+	return resp, err
+}
+
+// ValidateAt does the same as Validate, but also returns the endpoint URL, which the receipt was sent to.
+// It's useful when the env implements ContextEnv interface and the endpoint depends on the context.
+// The endpoint is returned even if validation failed.
+func (v *Validator) ValidateAt(ctx context.Context, receipt string, env Env) (*ValidationResponse, string, error) {
+	return v.validateAt(ctx, receipt, env, ValidateOptions{})
+}
+
+// ValidateOptions type represents the options of a single validation request.
+// The zero value means the default request, which Validate sends.
+type ValidateOptions struct {
+	// ExcludeOldTransactions makes the App Store include only the latest renewal transaction
+	// of each subscription into the latest receipt info, which is much shorter for long-lived subscribers.
+	ExcludeOldTransactions bool
+}
+
+// ValidateWithOptions does the same as Validate, but sends the request with the given options.
+func (v *Validator) ValidateWithOptions(ctx context.Context, receipt string, env Env, opts ValidateOptions) (*ValidationResponse, error) {
+	resp, _, err := v.validateAt(ctx, receipt, env, opts)
+	return resp, err
+}
+
+// validateAt implements ValidateAt with the given request options.
+func (v *Validator) validateAt(ctx context.Context, receipt string, env Env, opts ValidateOptions) (*ValidationResponse, string, error) {
+	if v.normalize {
+		receipt = normalizeReceipt(receipt)
+	}
+
+	endpoint := resolveEndpoint(ctx, env)
+	resp, err := v.validate(ctx, receipt, env, endpoint, opts)
+	if err != nil {
+		return nil, endpoint, redactError(err, receipt, v.password)
+	}
+	return resp, endpoint, nil
+}
+
+// validate implements validateAt without redaction of the returned errors.
+func (v *Validator) validate(ctx context.Context, receipt string, env Env, endpoint string, opts ValidateOptions) (*ValidationResponse, error) {
+	if v.err != nil {
+		return nil, v.err
+	}
+	if !v.allowEmpty && strings.TrimSpace(receipt) == "" {
+		return nil, ErrMalformedReceiptData
+	}
+
+	if v.inflight != nil {
+		select {
+		case v.inflight <- struct{}{}:
+			defer func() { <-v.inflight }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
 	payload := ValidationRequest{
-		ReceiptData: receipt,
-		Password:    v.password,
+		ReceiptData:            receipt,
+		Password:               v.password,
+		ExcludeOldTransactions: opts.ExcludeOldTransactions,
 	}
 
 	var body bytes.Buffer
@@ -73,40 +468,204 @@ func (v *Validator) Validate(ctx context.Context, receipt string, env Env) (*Val
 		return nil, fmt.Errorf("body payload encoding error: %v", err)
 	}
 
-	req, err := http.NewRequest(http.MethodPost, env.Endpoint(), &body)
+	var signatureName, signatureValue string
+	if v.signer != nil {
+		name, value, err := v.signer(body.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("body signing error: %v", err)
+		}
+		signatureName, signatureValue = name, value
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, &body)
 	if err != nil {
 		return nil, fmt.Errorf("http request creation error: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("User-Agent", v.userAgent)
+	if v.language != "" {
+		req.Header.Set("Accept-Language", v.language)
+	}
+	if signatureName != "" {
+		req.Header.Set(signatureName, signatureValue)
+	}
 
 	res, err := v.client.Do(req.WithContext(ctx))
 	if err != nil {
-		return nil, fmt.Errorf("http request failure: %v", err)
+		return nil, fmt.Errorf("http request failure: %w", err)
 	}
 	defer res.Body.Close()
 
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, newHTTPStatusError(res, receipt, v.password)
+	}
+
+	var resBody io.Reader = res.Body
+	if v.debug != nil {
+		raw, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return nil, fmt.Errorf("response reading error: %v", err)
+		}
+		v.debug.push(redactBytes(raw, receipt, v.password))
+		resBody = bytes.NewReader(raw)
+	}
+
+	// Apple omits the environment field in some responses,
+	// so it's preset with the environment which was actually used.
 	var response ValidationResponse
-	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+	if appleEnv, ok := env.(AppleEnv); ok {
+		response.Environment = appleEnv
+	}
+	if err := v.decodeBody(resBody, &response); err != nil {
 		return nil, err
 	}
+	response.submittedReceipt = receipt
+
+	for _, process := range v.processors {
+		if err := process(ctx, &response); err != nil {
+			return nil, fmt.Errorf("response processing error: %v", err)
+		}
+	}
 	return &response, nil
 }
 
+// ValidateDefault does the same as Validate, but uses the environment configured by WithDefaultEnv option.
+// Use Validate to override the environment for a single call.
+func (v *Validator) ValidateDefault(ctx context.Context, receipt string) (*ValidationResponse, error) {
+	return v.Validate(ctx, receipt, v.env)
+}
+
+// ValidateWithRetry does the same as Validate, but repeats the validation against the same environment
+// while the response is retryable: the is-retryable flag is set, or the status means the App Store
+// is temporarily unavailable (21005) or has an internal data access error (21009 and 21100-21199 range).
+// The validation is also repeated on temporary HTTPStatusError. Permanent errors, like the wrong secret, aren't retried.
+//
+// The delay before each retry is the one returned by the backoff of WithRetry option or the one requested
+// by the Retry-After header, whichever is longer. The validation stops with the context error when the context
+// is done or its deadline comes before the delay is over. The number of retries is limited by WithRetry
+// option. The last result is returned when retries are exhausted.
+func (v *Validator) ValidateWithRetry(ctx context.Context, receipt string, env Env) (*ValidationResponse, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := v.Validate(ctx, receipt, env)
+		if attempt >= v.retries {
+			return resp, err
+		}
+
+		var delay time.Duration
+		var statusErr *HTTPStatusError
+		switch {
+		case errors.As(err, &statusErr) && statusErr.Temporary():
+			delay = statusErr.RetryAfter
+		case err == nil && resp.retryable():
+		default:
+			return resp, err
+		}
+
+		if v.backoff != nil {
+			if d := v.backoff(attempt + 1); d > delay {
+				delay = d
+			}
+		}
+		if err := v.wait(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// AutoValidationError is returned by ValidateAuto when the first attempt is answered with the environment
+// mismatch status, but the validation against the other environment fails. It unwraps to the error of the retry.
+type AutoValidationError struct {
+	// Env is the environment of the retry, which failed.
+	Env AppleEnv
+	// Status is the status of the first attempt, either 21007 or 21008.
+	Status int
+	// Err is the error of the retry.
+	Err error
+}
+
+func (e *AutoValidationError) Error() string {
+	return fmt.Sprintf("validation with auto env failed: retry in %v after status %d: %v", e.Env, e.Status, e.Err)
+}
+
+// Unwrap returns the error of the retry.
+func (e *AutoValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateAuto validates the receipt against the production environment and falls back to the sandbox
+// environment if the App Store reports a sandbox receipt sent to production (21007), which is the case
+// for TestFlight and App Review receipts. Retryable responses are retried the same way as in ValidateWithRetry.
+//
+// When SandboxFirst is configured by WithAutoStrategy option, the receipt is validated against the sandbox
+// environment and falls back to the production environment if the App Store reports a production receipt
+// sent to sandbox (21008). It saves a round trip for apps, which mostly validate test receipts, like staging servers.
+// Sandbox configured by WithDefaultEnv option doesn't change the order.
+//
+// When a custom Env is configured by WithDefaultEnv option, Apple environment switching rules
+// don't apply, so the receipt is validated against the custom Env only, relying on is-retryable flag.
+//
+// When the fallback validation fails, the error is AutoValidationError, which could be checked by errors.As.
 func (v *Validator) ValidateAuto(ctx context.Context, receipt string) (*ValidationResponse, error) {
-	resp, err := v.Validate(ctx, receipt, Production)
+	if _, ok := v.env.(AppleEnv); !ok {
+		resp, err := v.ValidateWithRetry(ctx, receipt, v.env)
+		if err != nil {
+			return nil, fmt.Errorf("validation with auto env failed: %w", err)
+		}
+		return resp, nil
+	}
+
+	if v.strategy == SandboxFirst {
+		resp, err := v.ValidateWithRetry(ctx, receipt, Sandbox)
+		if err != nil {
+			return nil, fmt.Errorf("validation with auto env failed: %w", err)
+		}
+		if errors.Is(resp.StatusError(), ErrProductionOnSandbox) {
+			retryResp, retryErr := v.ValidateWithRetry(ctx, receipt, Production)
+			if retryErr != nil {
+				return nil, &AutoValidationError{Env: Production, Status: resp.Status, Err: retryErr}
+			}
+			return retryResp, nil
+		}
+		return resp, nil
+	}
+
+	resp, err := v.ValidateWithRetry(ctx, receipt, Production)
 	if err != nil {
-		return nil, fmt.Errorf("validation with auto env failed: %v", err)
+		return nil, fmt.Errorf("validation with auto env failed: %w", err)
 	}
-	if !resp.IsValid() && resp.StatusError() == ErrProductionOnSandbox {
-		retryResp, retryErr := v.Validate(ctx, receipt, Sandbox)
+	if errors.Is(resp.StatusError(), ErrSandboxOnProduction) {
+		retryResp, retryErr := v.ValidateWithRetry(ctx, receipt, Sandbox)
 		if retryErr != nil {
-			return nil, fmt.Errorf("validation with auto env failed: %v", err)
+			return nil, &AutoValidationError{Env: Sandbox, Status: resp.Status, Err: retryErr}
 		}
 		return retryResp, nil
 	}
 	return resp, nil
 }
 
+// DetectReceiptEnvironment returns the environment, which the receipt was generated for.
+// The receipt is validated against the production environment, the 21007 status
+// (sandbox receipt sent to production) means Sandbox and any other status means Production.
+func (v *Validator) DetectReceiptEnvironment(ctx context.Context, receipt string) (AppleEnv, error) {
+	resp, err := v.Validate(ctx, receipt, Production)
+	if err != nil {
+		return Production, fmt.Errorf("receipt environment detection failed: %v", err)
+	}
+	if errors.Is(resp.StatusError(), ErrSandboxOnProduction) {
+		return Sandbox, nil
+	}
+	return Production, nil
+}
+
+// decodeBody decodes the response body with the decoder configured by WithDecoder option
+// or with encoding/json decoder by default.
+func (v *Validator) decodeBody(body io.Reader, response *ValidationResponse) error {
+	if v.decode == nil {
+		return json.NewDecoder(body).Decode(response)
+	}
+	return v.decode(body, response)
+}
+
 // ValidationRequest type has the request properties.
 // Submit this struct as JSON payload of an HTTP POST request to AppStore backend.
 // In the test environment, use https://sandbox.itunes.apple.com/verifyReceipt as the url.
@@ -152,6 +711,47 @@ type ValidationResponse struct {
 	PendingRenewalInfo PendingRenewalInfos `json:"pending_renewal_info,omitempty"`
 	// Retry validation for this receipt. Only applicable to status codes 21100-21199
 	IsRetryable bool `json:"is-retryable,string,omitempty"`
+
+	// submittedReceipt is the receipt, which was sent by Validate to get this response.
+	submittedReceipt string
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+// The status is accepted both as JSON number and as numeric string, because some proxies and custom
+// endpoints return "status":"0". The response is always marshaled with the numeric status.
+func (r *ValidationResponse) UnmarshalJSON(b []byte) error {
+	type response ValidationResponse
+	aux := struct {
+		*response
+		Status json.RawMessage `json:"status"`
+	}{response: (*response)(r)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	if len(aux.Status) == 0 || string(aux.Status) == "null" {
+		return nil
+	}
+
+	raw := aux.Status
+	if raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return fmt.Errorf("can't unmarshal status %s: %v", raw, err)
+		}
+		raw = json.RawMessage(s)
+	}
+	status, err := strconv.Atoi(string(raw))
+	if err != nil {
+		return fmt.Errorf("can't unmarshal status %s: %v", aux.Status, err)
+	}
+	r.Status = status
+	return nil
+}
+
+// SubmittedReceipt returns the base64 receipt, which was sent to get the response, so it could be
+// validated again or stored without passing it around. It's empty for decoded or stored responses.
+func (r *ValidationResponse) SubmittedReceipt() string {
+	return r.submittedReceipt
 }
 
 // PendingRenewalInfos
@@ -161,6 +761,7 @@ type PendingRenewalInfos []PendingRenewalInfo
 // or a renewal that failed in the past for some reason.
 type PendingRenewalInfo struct {
 	ProductID                      string `json:"product_id"`
+	OriginalTransactionID          string `json:"original_transaction_id,omitempty"`
 	SubscriptionExpirationIntent   string `json:"expiration_intent"`
 	SubscriptionAutoRenewProductID string `json:"auto_renew_product_id"`
 	SubscriptionRetryFlag          string `json:"is_in_billing_retry_period"`
@@ -168,6 +769,35 @@ type PendingRenewalInfo struct {
 	SubscriptionPriceConsentStatus string `json:"price_consent_status"`
 }
 
+// find returns the pending renewal info of the given product.
+func (p PendingRenewalInfos) find(productID string) (PendingRenewalInfo, bool) {
+	for _, info := range p {
+		if info.ProductID == productID {
+			return info, true
+		}
+	}
+	return PendingRenewalInfo{}, false
+}
+
+// forInApp returns the pending renewal info of the subscription lineage of the given transaction.
+// Falls back to the product id when pending renewal info has no original transaction id.
+func (p PendingRenewalInfos) forInApp(inapp InApp) (PendingRenewalInfo, bool) {
+	if info, ok := p.findByOriginalTransactionID(inapp.OriginalTransactionID); ok && inapp.OriginalTransactionID != "" {
+		return info, true
+	}
+	return p.find(inapp.ProductID)
+}
+
+// findByOriginalTransactionID returns the pending renewal info of the given subscription lineage.
+func (p PendingRenewalInfos) findByOriginalTransactionID(originalTransactionID string) (PendingRenewalInfo, bool) {
+	for _, info := range p {
+		if info.OriginalTransactionID == originalTransactionID {
+			return info, true
+		}
+	}
+	return PendingRenewalInfo{}, false
+}
+
 var (
 	ErrMalformedJSON        = errors.New("the App Store could not read the JSON object you provided")
 	ErrMalformedReceiptData = errors.New("data in the receipt-data property was malformed or missing")
@@ -183,13 +813,43 @@ var (
 )
 
 // IsRenewable returns true if receipt containing auto-renewable subscriptions.
+// Apple occasionally omits either the latest receipt or the latest receipt info,
+// so any of them is enough: the latest receipt is present or the latest receipt info
+// contains an auto-renewable transaction.
 func (r *ValidationResponse) IsRenewable() bool {
-	if r.LatestReceipt != "" && len(r.LatestReceiptInfo) > 0 {
+	if r.LatestReceipt != "" {
 		return true
 	}
+	for _, inapp := range r.LatestReceiptInfo {
+		if inapp.IsAutoRenewable() {
+			return true
+		}
+	}
 	return false
 }
 
+// AllTransactions returns the transactions from all sections of the response: the latest receipt info,
+// the latest expired receipt info and the in-app purchases of the receipt, sorted by purchase date
+// from the oldest to the newest. A transaction present in several sections is returned once,
+// the latest receipt info takes precedence since it's the most up to date section.
+func (r *ValidationResponse) AllTransactions() InApps {
+	all := r.LatestReceiptInfo.Merge(r.LatestExpiredReceiptInfo).Merge(r.Receipt.InApp)
+	sort.SliceStable(all, func(a, b int) bool {
+		return all[a].PurchaseDateMS < all[b].PurchaseDateMS
+	})
+	return all
+}
+
+// IsSandbox returns true if the receipt was validated in the sandbox environment.
+func (r *ValidationResponse) IsSandbox() bool {
+	return r.Environment == Sandbox
+}
+
+// IsProduction returns true if the receipt was validated in the production environment.
+func (r *ValidationResponse) IsProduction() bool {
+	return r.Environment == Production
+}
+
 // IsValid returns true if validation was successful.
 func (r *ValidationResponse) IsValid() bool {
 	switch r.Status {
@@ -200,8 +860,21 @@ func (r *ValidationResponse) IsValid() bool {
 	}
 }
 
+// retryable returns true if Apple asks to retry the validation of the receipt later
+// or the status means a temporary App Store failure.
+func (r *ValidationResponse) retryable() bool {
+	if r.IsValid() {
+		return false
+	}
+	err := r.StatusError()
+	return r.IsRetryable || errors.Is(err, ErrInternalDataAccess) || errors.Is(err, ErrServerNotAvailable)
+}
+
 // StatusError returns error based on Status property of ValidationResponse.
+// Unknown statuses are reported with their code and match ErrUnknown with errors.Is.
 func (r *ValidationResponse) StatusError() error {
+	// The statuses documented by Apple for verifyReceipt. 21012 isn't documented, so there is
+	// no meaning to map it to and it's reported as unknown status until Apple publishes it.
 	errs := map[int]error{
 		0:     nil,
 		21000: ErrMalformedJSON,
@@ -212,6 +885,7 @@ func (r *ValidationResponse) StatusError() error {
 		21006: ErrSubscriptionExpired,
 		21007: ErrSandboxOnProduction,
 		21008: ErrProductionOnSandbox,
+		21009: ErrInternalDataAccess,
 		21010: ErrUnauthorizedReceipt,
 	}
 
@@ -223,5 +897,18 @@ func (r *ValidationResponse) StatusError() error {
 	if r.Status >= 21100 && r.Status <= 21199 {
 		return ErrInternalDataAccess
 	}
-	return ErrUnknown
+	return unknownStatusError(r.Status)
+}
+
+// unknownStatusError represents the status code, which is not documented by Apple yet.
+// It keeps the code in the message for investigation and matches ErrUnknown with errors.Is.
+type unknownStatusError int
+
+func (e unknownStatusError) Error() string {
+	return fmt.Sprintf("unknown App Store status %d", int(e))
+}
+
+// Is reports whether the target is ErrUnknown.
+func (e unknownStatusError) Is(target error) bool {
+	return target == ErrUnknown
 }
@@ -1,13 +1,54 @@
 package ios
 
 import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"math/rand"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
+// rewriteTransport type implements http.RoundTripper and used to redirect all requests to the test server.
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// testEnv type implements Env interface and used to send requests to the test server.
+type testEnv string
+
+func (e testEnv) Endpoint() string { return string(e) }
+
+// newRewriteClient return http.Client, which sends all requests to the given test server.
+func newRewriteClient(t *testing.T, server *httptest.Server) *http.Client {
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("can't parse test server url: %v", err)
+	}
+	return &http.Client{Transport: rewriteTransport{target: target}}
+}
+
 func TestNewValidator(t *testing.T) {
 	type args struct {
 		opts []ValidatorOption
@@ -20,15 +61,27 @@ func TestNewValidator(t *testing.T) {
 	tests := map[string]test{
 		"Default": {
 			args{[]ValidatorOption{}},
-			&Validator{client: &http.Client{Timeout: 10 * time.Second}, password: ""},
+			&Validator{client: &http.Client{Timeout: 10 * time.Second}, password: "", env: Production, userAgent: defaultUserAgent},
 		},
 		"WithHTTPClient": {
 			args{[]ValidatorOption{WithHTTPClient(&http.Client{Timeout: 20 * time.Second})}},
-			&Validator{client: &http.Client{Timeout: 20 * time.Second}, password: ""},
+			&Validator{client: &http.Client{Timeout: 20 * time.Second}, password: "", env: Production, userAgent: defaultUserAgent},
 		},
 		"WithPassword": {
 			args{[]ValidatorOption{WithPassword("pass")}},
-			&Validator{client: &http.Client{Timeout: 10 * time.Second}, password: "pass"},
+			&Validator{client: &http.Client{Timeout: 10 * time.Second}, password: "pass", env: Production, userAgent: defaultUserAgent},
+		},
+		"WithDefaultEnv": {
+			args{[]ValidatorOption{WithDefaultEnv(Sandbox)}},
+			&Validator{client: &http.Client{Timeout: 10 * time.Second}, password: "", env: Sandbox, userAgent: defaultUserAgent},
+		},
+		"WithAutoStrategy": {
+			args{[]ValidatorOption{WithAutoStrategy(SandboxFirst)}},
+			&Validator{client: &http.Client{Timeout: 10 * time.Second}, password: "", env: Production, userAgent: defaultUserAgent, strategy: SandboxFirst},
+		},
+		"WithMaxRetries": {
+			args{[]ValidatorOption{WithMaxRetries(3)}},
+			&Validator{client: &http.Client{Timeout: 10 * time.Second}, password: "", env: Production, retries: 3, userAgent: defaultUserAgent},
 		},
 	}
 
@@ -51,22 +104,25 @@ func TestValidationResponse_StatusError(t *testing.T) {
 	}
 
 	tests := map[string]test{
-		"OK":                        {args{status: 0}, nil},
-		"ErrMalformedJSON":          {args{status: 21000}, ErrMalformedJSON},
-		"ErrMalformedReceiptData":   {args{status: 21002}, ErrMalformedReceiptData},
-		"ErrNotAuthenticated":       {args{status: 21003}, ErrNotAuthenticated},
-		"ErrIncorrectSecret":        {args{status: 21004}, ErrIncorrectSecret},
-		"ErrServerNotAvailable":     {args{status: 21005}, ErrServerNotAvailable},
-		"ErrSubscriptionExpired":    {args{status: 21006}, ErrSubscriptionExpired},
-		"ErrSandboxOnProduction":    {args{status: 21007}, ErrSandboxOnProduction},
-		"ErrProductionOnSandbox":    {args{status: 21008}, ErrProductionOnSandbox},
-		"ErrUnauthorizedReceipt":    {args{status: 21010}, ErrUnauthorizedReceipt},
-		"ErrInternalDataAccess":     {args{status: 21100}, ErrInternalDataAccess},
-		"ErrInternalDataAccessRand": {args{status: randStatus(21100, 21199)}, ErrInternalDataAccess},
-		"ErrInternalDataAccessMid":  {args{status: 21133}, ErrInternalDataAccess},
-		"ErrInternalDataAccessEdge": {args{status: 21199}, ErrInternalDataAccess},
-		"ErrUnknown":                {args{status: 21200}, ErrUnknown},
-		"ErrUnknownRand":            {args{status: randStatus(21200, 50000)}, ErrUnknown},
+		"OK":                         {args{status: 0}, nil},
+		"ErrMalformedJSON":           {args{status: 21000}, ErrMalformedJSON},
+		"ErrMalformedReceiptData":    {args{status: 21002}, ErrMalformedReceiptData},
+		"ErrNotAuthenticated":        {args{status: 21003}, ErrNotAuthenticated},
+		"ErrIncorrectSecret":         {args{status: 21004}, ErrIncorrectSecret},
+		"ErrServerNotAvailable":      {args{status: 21005}, ErrServerNotAvailable},
+		"ErrSubscriptionExpired":     {args{status: 21006}, ErrSubscriptionExpired},
+		"ErrSandboxOnProduction":     {args{status: 21007}, ErrSandboxOnProduction},
+		"ErrProductionOnSandbox":     {args{status: 21008}, ErrProductionOnSandbox},
+		"ErrInternalDataAccess21009": {args{status: 21009}, ErrInternalDataAccess},
+		"ErrUnauthorizedReceipt":     {args{status: 21010}, ErrUnauthorizedReceipt},
+		"ErrInternalDataAccess":      {args{status: 21100}, ErrInternalDataAccess},
+		"ErrInternalDataAccessRand":  {args{status: randStatus(21100, 21199)}, ErrInternalDataAccess},
+		"ErrInternalDataAccessMid":   {args{status: 21133}, ErrInternalDataAccess},
+		"ErrInternalDataAccessEdge":  {args{status: 21199}, ErrInternalDataAccess},
+		"ErrUnknown":                 {args{status: 21200}, ErrUnknown},
+		"ErrUnknownRand":             {args{status: randStatus(21200, 50000)}, ErrUnknown},
+		"ErrUnknown21012":            {args{status: 21012}, ErrUnknown},
+		"ErrUnknownFarFuture":        {args{status: 99999}, ErrUnknown},
 	}
 
 	for name, tt := range tests {
@@ -74,11 +130,942 @@ func TestValidationResponse_StatusError(t *testing.T) {
 			r := &ValidationResponse{
 				Status: tt.args.status,
 			}
-			if err := r.StatusError(); err != tt.want {
+			err := r.StatusError()
+			if tt.want == nil && err != nil || !errors.Is(err, tt.want) {
 				t.Errorf("ValidationResponse.StatusError() error = %v, want %v", err, tt.want)
 			}
 		})
 	}
+
+	t.Run("UnknownCodeInMessage", func(t *testing.T) {
+		for _, status := range []int{21012, 99999} {
+			r := &ValidationResponse{Status: status}
+			want := fmt.Sprintf("unknown App Store status %d", status)
+			if err := r.StatusError(); err == nil || err.Error() != want {
+				t.Errorf("ValidationResponse.StatusError() error = %v, want %v", err, want)
+			}
+		}
+	})
+}
+
+func TestValidationResponse_IsRenewable(t *testing.T) {
+	type test struct {
+		response ValidationResponse
+		want     bool
+	}
+
+	renewable := InApps{{ProductID: "monthly", WebOrderLineItemID: "1000000039614547", ExpiresDateMS: 1530403200000}}
+	nonRenewable := InApps{{ProductID: "coins", Quantity: "1"}}
+
+	tests := map[string]test{
+		"Both":                  {ValidationResponse{LatestReceipt: "MIIT", LatestReceiptInfo: renewable}, true},
+		"OnlyLatestReceipt":     {ValidationResponse{LatestReceipt: "MIIT"}, true},
+		"OnlyLatestReceiptInfo": {ValidationResponse{LatestReceiptInfo: renewable}, true},
+		"OnlyNonRenewableInfo":  {ValidationResponse{LatestReceiptInfo: nonRenewable}, false},
+		"Neither":               {ValidationResponse{}, false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.response.IsRenewable(); got != tc.want {
+				t.Errorf("ValidationResponse.IsRenewable() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidationResponse_AllTransactions(t *testing.T) {
+	response := ValidationResponse{
+		Receipt: Receipt{InApp: InApps{
+			{ProductID: "coins", TransactionID: "1", PurchaseDateMS: 1000},
+			{ProductID: "monthly", TransactionID: "3", PurchaseDateMS: 3000, ExpiresDateMS: 4000},
+		}},
+		LatestReceiptInfo: InApps{
+			{ProductID: "monthly", TransactionID: "4", PurchaseDateMS: 4000, ExpiresDateMS: 5000},
+			{ProductID: "monthly", TransactionID: "3", PurchaseDateMS: 3000, ExpiresDateMS: 4000, AutoRenewStatus: "1"},
+		},
+		LatestExpiredReceiptInfo: InApps{
+			{ProductID: "weekly", TransactionID: "2", PurchaseDateMS: 2000, ExpiresDateMS: 2500},
+		},
+	}
+
+	got := response.AllTransactions()
+
+	var ids []string
+	for _, inapp := range got {
+		ids = append(ids, inapp.TransactionID)
+	}
+	if want := []string{"1", "2", "3", "4"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("ValidationResponse.AllTransactions() transaction ids = %v, want %v", ids, want)
+	}
+	if got[2].AutoRenewStatus != "1" {
+		t.Errorf("ValidationResponse.AllTransactions() took the overlapping transaction from the receipt, want from the latest receipt info")
+	}
+}
+
+func TestValidationResponse_UnmarshalJSON(t *testing.T) {
+	type test struct {
+		json        string
+		want        int
+		wantErr     bool
+		wantReceipt string
+	}
+
+	tests := map[string]test{
+		"Number":        {`{"status":0,"latest_receipt":"latest"}`, 0, false, "latest"},
+		"String":        {`{"status":"21002","latest_receipt":"latest"}`, 21002, false, "latest"},
+		"ZeroString":    {`{"status":"0"}`, 0, false, ""},
+		"Absent":        {`{"latest_receipt":"latest"}`, 0, false, "latest"},
+		"MalformedText": {`{"status":"ok"}`, 0, true, ""},
+		"Boolean":       {`{"status":true}`, 0, true, ""},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var response ValidationResponse
+			err := json.Unmarshal([]byte(tc.json), &response)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ValidationResponse.UnmarshalJSON() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if response.Status != tc.want || response.LatestReceipt != tc.wantReceipt {
+				t.Errorf("ValidationResponse.UnmarshalJSON() = status %v with latest receipt %q, want status %v with %q",
+					response.Status, response.LatestReceipt, tc.want, tc.wantReceipt)
+			}
+		})
+	}
+
+	t.Run("MarshalNumber", func(t *testing.T) {
+		b, err := json.Marshal(ValidationResponse{Status: 21002})
+		if err != nil {
+			t.Fatalf("json.Marshal() error = %v", err)
+		}
+		if !bytes.Contains(b, []byte(`"status":21002`)) {
+			t.Errorf("json.Marshal() = %s, want numeric status", b)
+		}
+	})
+}
+
+func TestValidationResponse_IsSandbox(t *testing.T) {
+	type test struct {
+		response       ValidationResponse
+		wantSandbox    bool
+		wantProduction bool
+	}
+
+	tests := map[string]test{
+		"Sandbox":    {ValidationResponse{Environment: Sandbox}, true, false},
+		"Production": {ValidationResponse{Environment: Production}, false, true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.response.IsSandbox(); got != tc.wantSandbox {
+				t.Errorf("ValidationResponse.IsSandbox() = %v, want %v", got, tc.wantSandbox)
+			}
+			if got := tc.response.IsProduction(); got != tc.wantProduction {
+				t.Errorf("ValidationResponse.IsProduction() = %v, want %v", got, tc.wantProduction)
+			}
+		})
+	}
+
+	t.Run("Omitted", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"status":0}`)
+		}))
+		defer server.Close()
+
+		transport := routeTransport{}
+		transport.route(t, Sandbox, server.URL)
+
+		v := NewValidator(WithHTTPClient(&http.Client{Transport: transport}))
+		resp, err := v.Validate(context.Background(), "receipt", Sandbox)
+		if err != nil {
+			t.Fatalf("Validator.Validate() error = %v", err)
+		}
+		if !resp.IsSandbox() || resp.IsProduction() {
+			t.Errorf("ValidationResponse.IsSandbox() = %v, IsProduction() = %v, want true and false", resp.IsSandbox(), resp.IsProduction())
+		}
+	})
+}
+
+func TestValidator_Validate_Environment(t *testing.T) {
+	type args struct {
+		env  AppleEnv
+		body string
+	}
+	type test struct {
+		args args
+		want AppleEnv
+	}
+
+	tests := map[string]test{
+		"OmittedSandbox":    {args{env: Sandbox, body: `{"status":0}`}, Sandbox},
+		"OmittedProduction": {args{env: Production, body: `{"status":0}`}, Production},
+		"Present":           {args{env: Sandbox, body: `{"status":0,"environment":"Production"}`}, Production},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, tc.args.body)
+			}))
+			defer server.Close()
+
+			v := NewValidator(WithHTTPClient(newRewriteClient(t, server)))
+			resp, err := v.Validate(context.Background(), "receipt", tc.args.env)
+			if err != nil {
+				t.Fatalf("Validator.Validate() error = %v", err)
+			}
+			if resp.Environment != tc.want {
+				t.Errorf("Validator.Validate() environment = %v, want %v", resp.Environment, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidator_ValidateDefault(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		fmt.Fprint(w, `{"status":0}`)
+	}))
+	defer server.Close()
+
+	v := NewValidator(WithDefaultEnv(testEnv(server.URL + "/default")))
+
+	t.Run("Default", func(t *testing.T) {
+		if _, err := v.ValidateDefault(context.Background(), "receipt"); err != nil {
+			t.Fatalf("Validator.ValidateDefault() error = %v", err)
+		}
+		if path != "/default" {
+			t.Errorf("Validator.ValidateDefault() requested %v, want %v", path, "/default")
+		}
+	})
+
+	t.Run("Override", func(t *testing.T) {
+		if _, err := v.Validate(context.Background(), "receipt", testEnv(server.URL+"/explicit")); err != nil {
+			t.Fatalf("Validator.Validate() error = %v", err)
+		}
+		if path != "/explicit" {
+			t.Errorf("Validator.Validate() requested %v, want %v", path, "/explicit")
+		}
+	})
+}
+
+func TestValidator_Validate_ResponseProcessor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":0}`)
+	}))
+	defer server.Close()
+
+	setReceipt := func(ctx context.Context, resp *ValidationResponse) error {
+		resp.LatestReceipt = "processed"
+		return nil
+	}
+
+	t.Run("Mutate", func(t *testing.T) {
+		v := NewValidator(WithResponseProcessor(setReceipt))
+		resp, err := v.Validate(context.Background(), "receipt", testEnv(server.URL))
+		if err != nil {
+			t.Fatalf("Validator.Validate() error = %v", err)
+		}
+		if resp.LatestReceipt != "processed" {
+			t.Errorf("Validator.Validate() response wasn't processed: %+v", resp)
+		}
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		var called bool
+		v := NewValidator(
+			WithResponseProcessor(func(ctx context.Context, resp *ValidationResponse) error {
+				return fmt.Errorf("rejected")
+			}),
+			WithResponseProcessor(func(ctx context.Context, resp *ValidationResponse) error {
+				called = true
+				return nil
+			}),
+		)
+		if _, err := v.Validate(context.Background(), "receipt", testEnv(server.URL)); err == nil {
+			t.Errorf("Validator.Validate() should return error it this case")
+		}
+		if called {
+			t.Errorf("Validator.Validate() should not call processors after the failed one")
+		}
+	})
+}
+
+func TestValidator_WithPasswordCopy(t *testing.T) {
+	var password string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ValidationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("can't decode request: %v", err)
+		}
+		password = req.Password
+		fmt.Fprint(w, `{"status":0}`)
+	}))
+	defer server.Close()
+
+	base := NewValidator(WithPassword("base"))
+
+	for _, secret := range []string{"first", "second", ""} {
+		t.Run(secret, func(t *testing.T) {
+			tenant := base.WithPasswordCopy(secret)
+			if tenant.client != base.client {
+				t.Errorf("Validator.WithPasswordCopy() should share the http client")
+			}
+			if _, err := tenant.Validate(context.Background(), "receipt", testEnv(server.URL)); err != nil {
+				t.Fatalf("Validator.Validate() error = %v", err)
+			}
+			if password != secret {
+				t.Errorf("Validator.Validate() posted password %q, want %q", password, secret)
+			}
+		})
+	}
+
+	if base.password != "base" {
+		t.Errorf("Validator.WithPasswordCopy() changed the original password to %q", base.password)
+	}
+}
+
+func TestValidator_Validate_Decoder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":21002}`)
+	}))
+	defer server.Close()
+
+	var invoked bool
+	decoder := func(r io.Reader, v interface{}) error {
+		invoked = true
+		return json.NewDecoder(r).Decode(v)
+	}
+
+	v := NewValidator(WithDecoder(decoder))
+	resp, err := v.Validate(context.Background(), "receipt", testEnv(server.URL))
+	if err != nil {
+		t.Fatalf("Validator.Validate() error = %v", err)
+	}
+	if !invoked {
+		t.Errorf("Validator.Validate() should use the custom decoder")
+	}
+	if resp.Status != 21002 {
+		t.Errorf("Validator.Validate() status = %v, want %v", resp.Status, 21002)
+	}
+}
+
+// newRetryableServer return the test server, which responds with retryable status the given number of times
+// and with the valid status afterwards. The counter of received requests is returned as well.
+func newRetryableServer(failures int) (*httptest.Server, *int) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= failures {
+			fmt.Fprint(w, `{"status":21100,"is-retryable":"true"}`)
+			return
+		}
+		fmt.Fprint(w, `{"status":0}`)
+	}))
+	return server, &requests
+}
+
+func TestValidator_ValidateWithRetry(t *testing.T) {
+	type args struct {
+		failures int
+		retries  int
+	}
+	type test struct {
+		args         args
+		wantStatus   int
+		wantRequests int
+	}
+
+	tests := map[string]test{
+		"RetryableThenSuccess": {args{failures: 2, retries: 3}, 0, 3},
+		"RetryableAlways":      {args{failures: 10, retries: 3}, 21100, 4},
+		"NoRetries":            {args{failures: 1, retries: 0}, 21100, 1},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			server, requests := newRetryableServer(tc.args.failures)
+			defer server.Close()
+
+			v := NewValidator(WithMaxRetries(tc.args.retries))
+			resp, err := v.ValidateWithRetry(context.Background(), "receipt", testEnv(server.URL))
+			if err != nil {
+				t.Fatalf("Validator.ValidateWithRetry() error = %v", err)
+			}
+			if resp.Status != tc.wantStatus {
+				t.Errorf("Validator.ValidateWithRetry() status = %v, want %v", resp.Status, tc.wantStatus)
+			}
+			if *requests != tc.wantRequests {
+				t.Errorf("Validator.ValidateWithRetry() made %v requests, want %v", *requests, tc.wantRequests)
+			}
+		})
+	}
+
+	t.Run("ValidateAuto", func(t *testing.T) {
+		server, requests := newRetryableServer(1)
+		defer server.Close()
+
+		v := NewValidator(WithMaxRetries(1), WithHTTPClient(newRewriteClient(t, server)))
+		resp, err := v.ValidateAuto(context.Background(), "receipt")
+		if err != nil {
+			t.Fatalf("Validator.ValidateAuto() error = %v", err)
+		}
+		if resp.Status != 0 || *requests != 2 {
+			t.Errorf("Validator.ValidateAuto() status = %v after %v requests, want 0 after 2", resp.Status, *requests)
+		}
+	})
+}
+
+func TestValidator_Validate_EmptyReceipt(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `{"status":0}`)
+	}))
+	defer server.Close()
+
+	t.Run("Rejected", func(t *testing.T) {
+		v := NewValidator()
+		for _, receipt := range []string{"", "  \n"} {
+			if _, err := v.Validate(context.Background(), receipt, testEnv(server.URL)); err != ErrMalformedReceiptData {
+				t.Errorf("Validator.Validate() error = %v, want %v", err, ErrMalformedReceiptData)
+			}
+		}
+		if requests != 0 {
+			t.Errorf("Validator.Validate() made %v requests for empty receipt, want 0", requests)
+		}
+	})
+
+	t.Run("Allowed", func(t *testing.T) {
+		v := NewValidator(WithAllowEmptyReceipt(true))
+		if _, err := v.Validate(context.Background(), "", testEnv(server.URL)); err != nil {
+			t.Fatalf("Validator.Validate() error = %v", err)
+		}
+		if requests != 1 {
+			t.Errorf("Validator.Validate() made %v requests, want 1", requests)
+		}
+	})
+}
+
+func TestWithProxy(t *testing.T) {
+	t.Run("Proxied", func(t *testing.T) {
+		var proxied string
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			proxied = r.URL.String()
+			fmt.Fprint(w, `{"status":0}`)
+		}))
+		defer proxy.Close()
+
+		v := NewValidator(WithProxy(proxy.URL))
+		if err := v.Err(); err != nil {
+			t.Fatalf("NewValidator() error = %v", err)
+		}
+
+		endpoint := "http://apple.invalid/verifyReceipt"
+		if _, err := v.Validate(context.Background(), "receipt", testEnv(endpoint)); err != nil {
+			t.Fatalf("Validator.Validate() error = %v", err)
+		}
+		if proxied != endpoint {
+			t.Errorf("proxy received request to %q, want %q", proxied, endpoint)
+		}
+	})
+
+	t.Run("KeepsClientUnchanged", func(t *testing.T) {
+		client := &http.Client{Timeout: time.Second}
+		v := NewValidator(WithHTTPClient(client), WithProxy("socks5://127.0.0.1:1080"))
+		if err := v.Err(); err != nil {
+			t.Fatalf("NewValidator() error = %v", err)
+		}
+		if client.Transport != nil || v.client.Timeout != time.Second {
+			t.Errorf("WithProxy() should copy the client preserving its settings")
+		}
+	})
+
+	for _, proxyURL := range []string{"ftp://proxy:21", "http://", "://proxy"} {
+		t.Run("Invalid "+proxyURL, func(t *testing.T) {
+			v := NewValidator(WithProxy(proxyURL))
+			if v.Err() == nil {
+				t.Errorf("NewValidator() should fail with proxy url %q", proxyURL)
+			}
+			if _, err := v.Validate(context.Background(), "receipt", Production); err != v.Err() {
+				t.Errorf("Validator.Validate() error = %v, want %v", err, v.Err())
+			}
+		})
+	}
+}
+
+func TestValidator_DetectReceiptEnvironment(t *testing.T) {
+	server, _ := NewTestServer(map[string]ValidationResponse{
+		"sandbox":    {Status: 21007},
+		"production": {Status: 0},
+	})
+	defer server.Close()
+
+	type args struct {
+		receipt string
+	}
+	type test struct {
+		args args
+		want AppleEnv
+	}
+
+	tests := map[string]test{
+		"Sandbox":    {args{receipt: "sandbox"}, Sandbox},
+		"Production": {args{receipt: "production"}, Production},
+	}
+
+	v := NewValidator(WithHTTPClient(newRewriteClient(t, server)))
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := v.DetectReceiptEnvironment(context.Background(), tc.args.receipt)
+			if err != nil {
+				t.Fatalf("Validator.DetectReceiptEnvironment() error = %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("Validator.DetectReceiptEnvironment() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("Error", func(t *testing.T) {
+		if _, err := v.DetectReceiptEnvironment(context.Background(), ""); err == nil {
+			t.Errorf("Validator.DetectReceiptEnvironment() should return error it this case")
+		}
+	})
+}
+
+func TestValidator_ValidateAuto_CustomEnv(t *testing.T) {
+	t.Run("NoEnvironmentSwitch", func(t *testing.T) {
+		var requests int
+		custom := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			fmt.Fprint(w, `{"status":21008}`)
+		}))
+		defer custom.Close()
+
+		var appleRequests int
+		apple := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			appleRequests++
+			fmt.Fprint(w, `{"status":0}`)
+		}))
+		defer apple.Close()
+
+		transport := routeTransport{}
+		transport.route(t, Production, apple.URL)
+		transport.route(t, Sandbox, apple.URL)
+
+		v := NewValidator(WithDefaultEnv(testEnv(custom.URL)), WithHTTPClient(&http.Client{Transport: transport}))
+		resp, err := v.ValidateAuto(context.Background(), "receipt")
+		if err != nil {
+			t.Fatalf("Validator.ValidateAuto() error = %v", err)
+		}
+		if resp.Status != 21008 || requests != 1 || appleRequests != 0 {
+			t.Errorf("Validator.ValidateAuto() status = %v after %v custom and %v apple requests, want 21008 after 1 and 0",
+				resp.Status, requests, appleRequests)
+		}
+	})
+
+	t.Run("Retryable", func(t *testing.T) {
+		server, requests := newRetryableServer(1)
+		defer server.Close()
+
+		v := NewValidator(WithDefaultEnv(testEnv(server.URL)), WithMaxRetries(1))
+		resp, err := v.ValidateAuto(context.Background(), "receipt")
+		if err != nil {
+			t.Fatalf("Validator.ValidateAuto() error = %v", err)
+		}
+		if resp.Status != 0 || *requests != 2 {
+			t.Errorf("Validator.ValidateAuto() status = %v after %v requests, want 0 after 2", resp.Status, *requests)
+		}
+	})
+}
+
+func TestWithMaxConcurrent(t *testing.T) {
+	const limit = 2
+
+	var current, max int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&current, 1)
+		defer atomic.AddInt32(&current, -1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		fmt.Fprint(w, `{"status":0}`)
+	}))
+	defer server.Close()
+
+	v := NewValidator(WithMaxConcurrent(limit))
+
+	t.Run("Limited", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for n := 0; n < 5*limit; n++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := v.Validate(context.Background(), "receipt", testEnv(server.URL)); err != nil {
+					t.Errorf("Validator.Validate() error = %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if got := atomic.LoadInt32(&max); got > limit {
+			t.Errorf("Validator.Validate() made %v simultaneous requests, want at most %v", got, limit)
+		}
+	})
+
+	t.Run("ContextDone", func(t *testing.T) {
+		for n := 0; n < limit; n++ {
+			v.inflight <- struct{}{}
+		}
+		defer func() {
+			for n := 0; n < limit; n++ {
+				<-v.inflight
+			}
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := v.Validate(ctx, "receipt", testEnv(server.URL)); err != context.DeadlineExceeded {
+			t.Errorf("Validator.Validate() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+}
+
+func TestWithBodySigner(t *testing.T) {
+	key := []byte("proxy-secret")
+	sign := func(body []byte) string {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(body)
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("can't read request body: %v", err)
+		}
+		if got, want := r.Header.Get("X-Body-Signature"), sign(body); !hmac.Equal([]byte(got), []byte(want)) {
+			t.Errorf("X-Body-Signature = %v, want %v", got, want)
+		}
+		fmt.Fprint(w, `{"status":0}`)
+	}))
+	defer server.Close()
+
+	v := NewValidator(WithPassword("secret"), WithBodySigner(func(body []byte) (string, string, error) {
+		return "X-Body-Signature", sign(body), nil
+	}))
+	if _, err := v.Validate(context.Background(), "receipt", testEnv(server.URL)); err != nil {
+		t.Fatalf("Validator.Validate() error = %v", err)
+	}
+
+	t.Run("SignerError", func(t *testing.T) {
+		v := NewValidator(WithBodySigner(func(body []byte) (string, string, error) {
+			return "", "", fmt.Errorf("no key")
+		}))
+		if _, err := v.Validate(context.Background(), "receipt", testEnv(server.URL)); err == nil {
+			t.Errorf("Validator.Validate() error = nil, want signing error")
+		}
+	})
+}
+
+func TestValidator_Close(t *testing.T) {
+	closed := make(chan struct{}, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":0}`)
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closed <- struct{}{}
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	v := NewValidator(WithHTTPClient(&http.Client{Transport: &http.Transport{}}))
+	if _, err := v.Validate(context.Background(), "receipt", testEnv(server.URL)); err != nil {
+		t.Fatalf("Validator.Validate() error = %v", err)
+	}
+
+	v.Close()
+	v.Close()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Errorf("Validator.Close() didn't close the idle connection")
+	}
+}
+
+func TestValidator_ValidateWithOptions(t *testing.T) {
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("can't decode request body: %v", err)
+		}
+		fmt.Fprint(w, `{"status":0}`)
+	}))
+	defer server.Close()
+
+	type args struct {
+		opts *ValidateOptions
+	}
+	type test struct {
+		args        args
+		wantPresent bool
+	}
+
+	tests := map[string]test{
+		"Validate":               {args{opts: nil}, false},
+		"ZeroOptions":            {args{opts: &ValidateOptions{}}, false},
+		"ExcludeOldTransactions": {args{opts: &ValidateOptions{ExcludeOldTransactions: true}}, true},
+	}
+
+	v := NewValidator()
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var err error
+			if tc.args.opts == nil {
+				_, err = v.Validate(context.Background(), "receipt", testEnv(server.URL))
+			} else {
+				_, err = v.ValidateWithOptions(context.Background(), "receipt", testEnv(server.URL), *tc.args.opts)
+			}
+			if err != nil {
+				t.Fatalf("Validator.ValidateWithOptions() error = %v", err)
+			}
+
+			value, ok := body["exclude-old-transactions"]
+			if ok != tc.wantPresent || (ok && value != true) {
+				t.Errorf("request body = %v, want exclude-old-transactions present %v", body, tc.wantPresent)
+			}
+		})
+	}
+}
+
+func TestWithUserAgent(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("User-Agent")
+		fmt.Fprint(w, `{"status":0}`)
+	}))
+	defer server.Close()
+
+	type args struct {
+		opts []ValidatorOption
+	}
+	type test struct {
+		args args
+		want string
+	}
+
+	tests := map[string]test{
+		"Default":  {args{}, "goinapp/" + Version},
+		"Override": {args{opts: []ValidatorOption{WithUserAgent("billing-service/2.3")}}, "billing-service/2.3"},
+		"Empty":    {args{opts: []ValidatorOption{WithUserAgent("")}}, "goinapp/" + Version},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got = ""
+			v := NewValidator(tc.args.opts...)
+			if _, err := v.Validate(context.Background(), "receipt", testEnv(server.URL)); err != nil {
+				t.Fatalf("Validator.Validate() error = %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("User-Agent = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWithAcceptLanguage(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Accept-Language")
+		fmt.Fprint(w, `{"status":0}`)
+	}))
+	defer server.Close()
+
+	type args struct {
+		tag string
+	}
+	type test struct {
+		args    args
+		wantErr bool
+	}
+
+	tests := map[string]test{
+		"Language":      {args{tag: "en"}, false},
+		"Region":        {args{tag: "en-US"}, false},
+		"ScriptRegion":  {args{tag: "zh-Hant-TW"}, false},
+		"NumericRegion": {args{tag: "es-419"}, false},
+		"Empty":         {args{tag: ""}, true},
+		"Underscore":    {args{tag: "en_US"}, true},
+		"HeaderList":    {args{tag: "en-US,en;q=0.9"}, true},
+		"TooLongSubtag": {args{tag: "en-toolongsubtag"}, true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got = ""
+			v := NewValidator(WithAcceptLanguage(tc.args.tag))
+			if err := v.Err(); (err != nil) != tc.wantErr {
+				t.Fatalf("Validator.Err() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+
+			if _, err := v.Validate(context.Background(), "receipt", testEnv(server.URL)); err != nil {
+				t.Fatalf("Validator.Validate() error = %v", err)
+			}
+			if got != tc.args.tag {
+				t.Errorf("Accept-Language = %v, want %v", got, tc.args.tag)
+			}
+		})
+	}
+}
+
+func TestWithReceiptNormalization(t *testing.T) {
+	var got ValidationRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("can't decode request body: %v", err)
+		}
+		fmt.Fprint(w, `{"status":0}`)
+	}))
+	defer server.Close()
+
+	raw := []byte{0xfb, 0xff, 0xbf, 0x4d, 0x49, 0x49, 0x54, 0xfe}
+
+	type args struct {
+		receipt string
+	}
+	type test struct {
+		args args
+		want string
+	}
+
+	tests := map[string]test{
+		"URLSafe":       {args{receipt: base64.URLEncoding.EncodeToString(raw)}, base64.StdEncoding.EncodeToString(raw)},
+		"URLSafeRaw":    {args{receipt: base64.RawURLEncoding.EncodeToString(raw)}, base64.StdEncoding.EncodeToString(raw)},
+		"Standard":      {args{receipt: base64.StdEncoding.EncodeToString(raw)}, base64.StdEncoding.EncodeToString(raw)},
+		"TrailingSpace": {args{receipt: base64.StdEncoding.EncodeToString(raw) + "\n"}, base64.StdEncoding.EncodeToString(raw)},
+	}
+
+	v := NewValidator(WithReceiptNormalization(true))
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := v.Validate(context.Background(), tc.args.receipt, testEnv(server.URL)); err != nil {
+				t.Fatalf("Validator.Validate() error = %v", err)
+			}
+			if got.ReceiptData != tc.want {
+				t.Errorf("posted receipt-data = %v, want %v", got.ReceiptData, tc.want)
+			}
+		})
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		receipt := base64.RawURLEncoding.EncodeToString(raw)
+		if _, err := NewValidator().Validate(context.Background(), receipt, testEnv(server.URL)); err != nil {
+			t.Fatalf("Validator.Validate() error = %v", err)
+		}
+		if got.ReceiptData != receipt {
+			t.Errorf("posted receipt-data = %v, want %v", got.ReceiptData, receipt)
+		}
+	})
+}
+
+func TestValidationResponse_SubmittedReceipt(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":0,"latest_receipt":"latest"}`)
+	}))
+	defer server.Close()
+
+	const receipt = "MIIT0AYJKoZIhvcNAQcCoIITwTCCE70CAQExCzAJBgUrDgMCGgUA"
+	resp, err := NewValidator().Validate(context.Background(), receipt, testEnv(server.URL))
+	if err != nil {
+		t.Fatalf("Validator.Validate() error = %v", err)
+	}
+	if got := resp.SubmittedReceipt(); got != receipt {
+		t.Errorf("ValidationResponse.SubmittedReceipt() = %v, want %v", got, receipt)
+	}
+}
+
+type tenantKey struct{}
+
+// tenantEnv type implements ContextEnv interface and used to route requests by the tenant from the context.
+type tenantEnv map[string]string
+
+func (e tenantEnv) Endpoint() string { return e[""] }
+
+func (e tenantEnv) EndpointContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return e[tenant]
+}
+
+func TestValidator_ValidateAt(t *testing.T) {
+	hits := map[string]int{}
+	newServer := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[name]++
+			fmt.Fprint(w, `{"status":0}`)
+		}))
+	}
+	eu, us := newServer("eu"), newServer("us")
+	defer eu.Close()
+	defer us.Close()
+
+	env := tenantEnv{"": us.URL, "acme": eu.URL}
+
+	type args struct {
+		tenant string
+	}
+	type test struct {
+		args args
+		want string
+	}
+
+	tests := map[string]test{
+		"Tenant":  {args{tenant: "acme"}, eu.URL},
+		"Default": {args{tenant: ""}, us.URL},
+	}
+
+	v := NewValidator()
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), tenantKey{}, tc.args.tenant)
+			_, endpoint, err := v.ValidateAt(ctx, "receipt", env)
+			if err != nil {
+				t.Fatalf("Validator.ValidateAt() error = %v", err)
+			}
+			if endpoint != tc.want {
+				t.Errorf("Validator.ValidateAt() endpoint = %v, want %v", endpoint, tc.want)
+			}
+		})
+	}
+
+	if hits["eu"] != 1 || hits["us"] != 1 {
+		t.Errorf("Validator.ValidateAt() hit servers %v, want each once", hits)
+	}
+
+	t.Run("PlainEnv", func(t *testing.T) {
+		_, endpoint, err := v.ValidateAt(context.Background(), "receipt", testEnv(us.URL))
+		if err != nil || endpoint != us.URL {
+			t.Errorf("Validator.ValidateAt() = %v, %v, want %v", endpoint, err, us.URL)
+		}
+	})
 }
 
 func randStatus(min, max int) int {
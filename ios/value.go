@@ -0,0 +1,29 @@
+package ios
+
+// LifetimeValue return the sum of prices of all paid transactions according to the given price map,
+// which maps product id to its price. Refunded, trial and introductory offer transactions are excluded.
+// Products missing in the price map are counted as free.
+func (i InApps) LifetimeValue(prices map[string]float64) float64 {
+	return i.lifetimeValue(prices, nil)
+}
+
+// LifetimeValueWithIntro does the same as LifetimeValue, but also counts the introductory offer
+// transactions with the discounted prices from the introPrices map. Trial transactions are still excluded.
+func (i InApps) LifetimeValueWithIntro(prices, introPrices map[string]float64) float64 {
+	return i.lifetimeValue(prices, introPrices)
+}
+
+func (i InApps) lifetimeValue(prices, introPrices map[string]float64) float64 {
+	var value float64
+	for _, inapp := range i {
+		switch {
+		case inapp.Refunded(), inapp.IsTrialPeriod:
+			continue
+		case inapp.IsInIntroOfferPeriod:
+			value += introPrices[inapp.ProductID]
+		default:
+			value += prices[inapp.ProductID]
+		}
+	}
+	return value
+}
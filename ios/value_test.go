@@ -0,0 +1,37 @@
+package ios
+
+import (
+	"testing"
+)
+
+func TestInApps_LifetimeValue(t *testing.T) {
+	inapps := InApps{
+		{ProductID: "monthly", TransactionID: "1", IsTrialPeriod: true},
+		{ProductID: "monthly", TransactionID: "2", IsInIntroOfferPeriod: true},
+		{ProductID: "monthly", TransactionID: "3"},
+		{ProductID: "monthly", TransactionID: "4", CancellationDateMS: 1530403200000, CancellationReason: "0"},
+		{ProductID: "coins", TransactionID: "5"},
+		{ProductID: "unknown", TransactionID: "6"},
+	}
+	prices := map[string]float64{"monthly": 9.99, "coins": 0.99}
+	introPrices := map[string]float64{"monthly": 0.99}
+
+	type test struct {
+		got  float64
+		want float64
+	}
+
+	tests := map[string]test{
+		"Default":   {inapps.LifetimeValue(prices), 9.99 + 0.99},
+		"WithIntro": {inapps.LifetimeValueWithIntro(prices, introPrices), 0.99 + 9.99 + 0.99},
+		"Empty":     {InApps{}.LifetimeValue(prices), 0},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if diff := tc.got - tc.want; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("InApps.LifetimeValue() = %v, want %v", tc.got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package ios
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrBadCertificateChain is returned by Verifier when the x5c certificate chain is malformed,
+	// out of order or doesn't chain up to the root certificate.
+	ErrBadCertificateChain = errors.New("bad JWS certificate chain")
+	// ErrCertificateExpired is returned by Verifier when a certificate of the chain is expired or not yet valid.
+	ErrCertificateExpired = errors.New("JWS certificate is expired")
+	// ErrBadSignature is returned by Verifier when the JWS signature doesn't match the payload.
+	ErrBadSignature = errors.New("bad JWS signature")
+)
+
+var (
+	// oidAppStoreReceiptSigning is the extension, which marks the App Store receipt signing leaf certificate.
+	oidAppStoreReceiptSigning = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 11, 1}
+	// oidAppleWWDRIntermediate is the extension, which marks the Apple WWDR intermediate certificate.
+	oidAppleWWDRIntermediate = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 2, 1}
+)
+
+// maxChainLength is the length of the App Store chain: the leaf, the intermediate and the root certificates.
+const maxChainLength = 3
+
+// Verifier type verifies JWS signed by the App Store, like the signed payload of NotificationV2
+// or the signed transaction and renewal information.
+type Verifier struct {
+	root  *x509.Certificate
+	roots *x509.CertPool
+}
+
+// NewVerifier return a new instance of Verifier, which trusts the chains issued by the given root certificate.
+// For the App Store it's Apple Root CA - G3, which is available at https://www.apple.com/certificateauthority/.
+func NewVerifier(rootCert *x509.Certificate) *Verifier {
+	return &Verifier{root: rootCert}
+}
+
+// Verify verifies the JWS in compact serialization and returns its payload.
+//
+// The x5c header must contain the certificate chain ordered from the leaf to the root, each certificate
+// must be signed by the next one and the last one must be the root certificate or be signed by it.
+// The chain is limited to the leaf, the intermediate and the root certificates, the leaf must have
+// the App Store receipt signing extension and the intermediate must have the Apple WWDR extension,
+// so the other certificates issued by Apple, like developer ones, can't sign the payload.
+// Then the ES256 signature is verified with the key of the leaf certificate.
+// The error is ErrBadCertificateChain, ErrCertificateExpired, ErrBadSignature or ErrMalformedJWS,
+// which could be checked by errors.Is.
+func (v *Verifier) Verify(jws string) ([]byte, error) {
+	header, payload, err := parseJWS(jws)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := parseCertificateChain(header.X5C)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.verifyChain(chain); err != nil {
+		return nil, err
+	}
+
+	if header.Alg != "ES256" {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrBadSignature, header.Alg)
+	}
+	dot := strings.LastIndex(jws, ".")
+	if err := verifyES256(chain[0], jws[:dot], jws[dot+1:]); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// parseCertificateChain parses the base64 encoded DER certificates of x5c header.
+func parseCertificateChain(x5c []string) ([]*x509.Certificate, error) {
+	if len(x5c) == 0 {
+		return nil, fmt.Errorf("%w: x5c header is empty", ErrBadCertificateChain)
+	}
+	if len(x5c) > maxChainLength {
+		return nil, fmt.Errorf("%w: x5c header has %d certificates, want at most %d", ErrBadCertificateChain, len(x5c), maxChainLength)
+	}
+
+	chain := make([]*x509.Certificate, 0, len(x5c))
+	for n, encoded := range x5c {
+		der, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("%w: can't decode certificate %d: %v", ErrBadCertificateChain, n, err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("%w: can't parse certificate %d: %v", ErrBadCertificateChain, n, err)
+		}
+		chain = append(chain, cert)
+	}
+	return chain, nil
+}
+
+// verifyChain checks that the chain is ordered from the leaf to the root, chains up to the root certificate,
+// has Apple marker extensions and every certificate is valid at the current time.
+func (v *Verifier) verifyChain(chain []*x509.Certificate) error {
+	if v.root == nil && v.roots == nil {
+		return fmt.Errorf("%w: verifier has no root certificate", ErrBadCertificateChain)
+	}
+	if len(chain) < 2 {
+		return fmt.Errorf("%w: chain has no intermediate certificate", ErrBadCertificateChain)
+	}
+	if !hasExtension(chain[0], oidAppStoreReceiptSigning) {
+		return fmt.Errorf("%w: leaf certificate has no App Store receipt signing extension %v",
+			ErrBadCertificateChain, oidAppStoreReceiptSigning)
+	}
+	if !hasExtension(chain[1], oidAppleWWDRIntermediate) {
+		return fmt.Errorf("%w: intermediate certificate has no Apple WWDR extension %v",
+			ErrBadCertificateChain, oidAppleWWDRIntermediate)
+	}
+
+	now := timeNow()
+	certs := append([]*x509.Certificate(nil), chain...)
+	if v.root != nil {
+		certs = append(certs, v.root)
+	}
+	for n, cert := range certs {
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return fmt.Errorf("%w: certificate %d %q is valid from %v till %v",
+				ErrCertificateExpired, n, cert.Subject.CommonName, cert.NotBefore, cert.NotAfter)
+		}
+	}
+
+	for n := 0; n < len(chain)-1; n++ {
+		if err := chain[n].CheckSignatureFrom(chain[n+1]); err != nil {
+			return fmt.Errorf("%w: certificate %d isn't issued by certificate %d: %v", ErrBadCertificateChain, n, n+1, err)
+		}
+	}
+	last := chain[len(chain)-1]
+	if v.root == nil {
+		return verifyPool(last, v.roots, now)
+	}
+	if !last.Equal(v.root) {
+		if err := last.CheckSignatureFrom(v.root); err != nil {
+			return fmt.Errorf("%w: certificate %d isn't issued by the root certificate: %v", ErrBadCertificateChain, len(chain)-1, err)
+		}
+	}
+	return nil
+}
+
+// verifyPool checks that the last certificate of the chain is one of the root certificates of the pool
+// or is issued by one of them.
+func verifyPool(last *x509.Certificate, roots *x509.CertPool, now time.Time) error {
+	_, err := last.Verify(x509.VerifyOptions{
+		Roots:       roots,
+		CurrentTime: now,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	var invalidErr x509.CertificateInvalidError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &invalidErr) && invalidErr.Reason == x509.Expired:
+		return fmt.Errorf("%w: %v", ErrCertificateExpired, err)
+	default:
+		return fmt.Errorf("%w: chain doesn't chain up to the root certificates: %v", ErrBadCertificateChain, err)
+	}
+}
+
+// VerifyTransactions verifies the signed transactions of StoreKit 2 against the root certificates
+// without any network and decodes them. The chain of each transaction is checked the same way as
+// by Verifier, but it may end at any root certificate of the pool.
+//
+// Both returned slices have the length of jwsList. The transaction and the error at the same index
+// belong to the same JWS: the error is nil for the verified transaction, otherwise the transaction is zero.
+func VerifyTransactions(jwsList []string, roots *x509.CertPool) ([]JWSTransaction, []error) {
+	verifier := &Verifier{roots: roots}
+	transactions := make([]JWSTransaction, len(jwsList))
+	errs := make([]error, len(jwsList))
+	for n, jws := range jwsList {
+		payload, err := verifier.Verify(jws)
+		if err != nil {
+			errs[n] = err
+			continue
+		}
+		var transaction JWSTransaction
+		if err := json.Unmarshal(payload, &transaction); err != nil {
+			errs[n] = fmt.Errorf("can't unmarshal transaction: %v", err)
+			continue
+		}
+		transactions[n] = transaction
+	}
+	return transactions, errs
+}
+
+// hasExtension returns true if the certificate has the extension with the given id.
+func hasExtension(cert *x509.Certificate, id asn1.ObjectIdentifier) bool {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyES256 verifies the signature of the signing input, which is the JWS without the signature part,
+// with the ECDSA P-256 key of the certificate. The signature is base64url encoded R and S values of 32 bytes each.
+func verifyES256(cert *x509.Certificate, signingInput, signature string) error {
+	key, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok || key.Curve != elliptic.P256() {
+		return fmt.Errorf("%w: certificate key isn't ECDSA P-256", ErrBadSignature)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || len(sig) != 64 {
+		return fmt.Errorf("%w: malformed signature", ErrBadSignature)
+	}
+
+	hash := sha256.Sum256([]byte(signingInput))
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(key, hash[:], r, s) {
+		return ErrBadSignature
+	}
+	return nil
+}
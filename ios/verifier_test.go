@@ -0,0 +1,238 @@
+package ios
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA type represents the certificate with its private key used to sign test certificates and JWS.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCA return the certificate issued by the given parent, or self-signed one if the parent is nil,
+// with the given marker extensions.
+func newTestCA(t *testing.T, name string, parent *testCA, notAfter time.Time, oids ...asn1.ObjectIdentifier) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("can't generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, oid := range oids {
+		// Apple marker extensions have ASN.1 NULL value.
+		template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{Id: oid, Value: []byte{0x05, 0x00}})
+	}
+	issuer, signer := template, key
+	if parent != nil {
+		issuer, signer = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatalf("can't create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("can't parse certificate: %v", err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+// signJWS return the JWS with the given payload signed by the key of the first certificate of the chain.
+func signJWS(t *testing.T, alg string, chain []*testCA, payload []byte) string {
+	t.Helper()
+	header := jwsHeader{Alg: alg}
+	for _, ca := range chain {
+		header.X5C = append(header.X5C, base64.StdEncoding.EncodeToString(ca.cert.Raw))
+	}
+	h, err := json.Marshal(header)
+	if err != nil {
+		t.Fatalf("can't marshal JWS header: %v", err)
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, chain[0].key, hash[:])
+	if err != nil {
+		t.Fatalf("can't sign JWS: %v", err)
+	}
+	// R and S are big-endian and left-padded to 32 bytes each.
+	sig := make([]byte, 64)
+	rb, sb := r.Bytes(), s.Bytes()
+	copy(sig[32-len(rb):32], rb)
+	copy(sig[64-len(sb):], sb)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	validTill := now.AddDate(1, 0, 0)
+	root := newTestCA(t, "root", nil, validTill)
+	intermediate := newTestCA(t, "intermediate", root, validTill, oidAppleWWDRIntermediate)
+	leaf := newTestCA(t, "leaf", intermediate, validTill, oidAppStoreReceiptSigning)
+	expiredLeaf := newTestCA(t, "expired leaf", intermediate, now.AddDate(0, -1, 0), oidAppStoreReceiptSigning)
+	developerLeaf := newTestCA(t, "developer leaf", intermediate, validTill)
+	plainIntermediate := newTestCA(t, "plain intermediate", root, validTill)
+	plainIntermediateLeaf := newTestCA(t, "plain intermediate leaf", plainIntermediate, validTill, oidAppStoreReceiptSigning)
+	subIntermediate := newTestCA(t, "sub intermediate", intermediate, validTill, oidAppleWWDRIntermediate)
+	longChainLeaf := newTestCA(t, "long chain leaf", subIntermediate, validTill, oidAppStoreReceiptSigning)
+	otherRoot := newTestCA(t, "other root", nil, validTill)
+	otherIntermediate := newTestCA(t, "other intermediate", otherRoot, validTill, oidAppleWWDRIntermediate)
+	otherLeaf := newTestCA(t, "other leaf", otherIntermediate, validTill, oidAppStoreReceiptSigning)
+
+	payload := []byte(`{"notificationType":"DID_RENEW"}`)
+	valid := signJWS(t, "ES256", []*testCA{leaf, intermediate, root}, payload)
+	parts := strings.Split(valid, ".")
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"notificationType":"REFUND"}`)) + "." + parts[2]
+
+	type test struct {
+		jws     string
+		wantErr error
+	}
+
+	tests := map[string]test{
+		"Valid":               {valid, nil},
+		"ValidWithoutRoot":    {signJWS(t, "ES256", []*testCA{leaf, intermediate}, payload), nil},
+		"TamperedPayload":     {tampered, ErrBadSignature},
+		"OutOfOrderChain":     {signJWS(t, "ES256", []*testCA{leaf, root, intermediate}, payload), ErrBadCertificateChain},
+		"UntrustedRoot":       {signJWS(t, "ES256", []*testCA{otherLeaf, otherIntermediate, otherRoot}, payload), ErrBadCertificateChain},
+		"ExpiredLeaf":         {signJWS(t, "ES256", []*testCA{expiredLeaf, intermediate, root}, payload), ErrCertificateExpired},
+		"SignedByOtherKey":    {signJWS(t, "ES256", []*testCA{{cert: leaf.cert, key: intermediate.key}, intermediate, root}, payload), ErrBadSignature},
+		"UnsupportedAlg":      {signJWS(t, "HS256", []*testCA{leaf, intermediate, root}, payload), ErrBadSignature},
+		"LeafWithoutOID":      {signJWS(t, "ES256", []*testCA{developerLeaf, intermediate, root}, payload), ErrBadCertificateChain},
+		"IntermediateNoOID":   {signJWS(t, "ES256", []*testCA{plainIntermediateLeaf, plainIntermediate, root}, payload), ErrBadCertificateChain},
+		"LeafOnly":            {signJWS(t, "ES256", []*testCA{leaf}, payload), ErrBadCertificateChain},
+		"TooLongChain":        {signJWS(t, "ES256", []*testCA{longChainLeaf, subIntermediate, intermediate, root}, payload), ErrBadCertificateChain},
+		"EmptyChain":          {unsignedJWS(t, jwsHeader{Alg: "ES256"}, payload), ErrBadCertificateChain},
+		"MalformedJWS":        {parts[0] + "." + parts[1], ErrMalformedJWS},
+		"MalformedSignature":  {parts[0] + "." + parts[1] + ".c2ln", ErrBadSignature},
+		"MalformedChainEntry": {unsignedJWS(t, jwsHeader{Alg: "ES256", X5C: []string{"!!!"}}, payload), ErrBadCertificateChain},
+	}
+
+	verifier := NewVerifier(root.cert)
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := verifier.Verify(tc.jws)
+			if tc.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Verifier.Verify() error = %v", err)
+				}
+				if string(got) != string(payload) {
+					t.Errorf("Verifier.Verify() = %s, want %s", got, payload)
+				}
+				return
+			}
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("Verifier.Verify() error = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyTransactions(t *testing.T) {
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	validTill := now.AddDate(1, 0, 0)
+	root := newTestCA(t, "root", nil, validTill)
+	intermediate := newTestCA(t, "intermediate", root, validTill, oidAppleWWDRIntermediate)
+	leaf := newTestCA(t, "leaf", intermediate, validTill, oidAppStoreReceiptSigning)
+	expiredRoot := newTestCA(t, "expired root", nil, now.AddDate(0, -1, 0))
+	expiredRootIntermediate := newTestCA(t, "expired root intermediate", expiredRoot, validTill, oidAppleWWDRIntermediate)
+	expiredRootLeaf := newTestCA(t, "expired root leaf", expiredRootIntermediate, validTill, oidAppStoreReceiptSigning)
+	otherRoot := newTestCA(t, "other root", nil, validTill)
+	otherIntermediate := newTestCA(t, "other intermediate", otherRoot, validTill, oidAppleWWDRIntermediate)
+	otherLeaf := newTestCA(t, "other leaf", otherIntermediate, validTill, oidAppStoreReceiptSigning)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root.cert)
+	roots.AddCert(expiredRoot.cert)
+
+	transaction := func(id string) []byte {
+		b, err := json.Marshal(JWSTransaction{TransactionID: id, ProductID: "monthly"})
+		if err != nil {
+			t.Fatalf("can't marshal transaction: %v", err)
+		}
+		return b
+	}
+	valid := signJWS(t, "ES256", []*testCA{leaf, intermediate, root}, transaction("1"))
+	parts := strings.Split(valid, ".")
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString(transaction("2")) + "." + parts[2]
+
+	type test struct {
+		jws     string
+		wantID  string
+		wantErr error
+	}
+
+	tests := []test{
+		{valid, "1", nil},
+		{tampered, "", ErrBadSignature},
+		{signJWS(t, "ES256", []*testCA{leaf, intermediate}, transaction("3")), "3", nil},
+		{signJWS(t, "ES256", []*testCA{otherLeaf, otherIntermediate, otherRoot}, transaction("4")), "", ErrBadCertificateChain},
+		{signJWS(t, "ES256", []*testCA{expiredRootLeaf, expiredRootIntermediate}, transaction("5")), "", ErrCertificateExpired},
+		{parts[0] + "." + parts[1], "", ErrMalformedJWS},
+	}
+
+	jwsList := make([]string, len(tests))
+	for n, tc := range tests {
+		jwsList[n] = tc.jws
+	}
+
+	transactions, errs := VerifyTransactions(jwsList, roots)
+	if len(transactions) != len(tests) || len(errs) != len(tests) {
+		t.Fatalf("VerifyTransactions() = %d transactions and %d errors, want %d", len(transactions), len(errs), len(tests))
+	}
+	for n, tc := range tests {
+		if tc.wantErr == nil && errs[n] != nil {
+			t.Errorf("VerifyTransactions()[%d] error = %v", n, errs[n])
+		}
+		if tc.wantErr != nil && !errors.Is(errs[n], tc.wantErr) {
+			t.Errorf("VerifyTransactions()[%d] error = %v, want %v", n, errs[n], tc.wantErr)
+		}
+		if transactions[n].TransactionID != tc.wantID {
+			t.Errorf("VerifyTransactions()[%d] = transaction %q, want %q", n, transactions[n].TransactionID, tc.wantID)
+		}
+	}
+
+	t.Run("NoRoots", func(t *testing.T) {
+		_, errs := VerifyTransactions([]string{valid}, nil)
+		if !errors.Is(errs[0], ErrBadCertificateChain) {
+			t.Errorf("VerifyTransactions() error = %v, want %v", errs[0], ErrBadCertificateChain)
+		}
+	})
+
+	t.Run("MalformedPayload", func(t *testing.T) {
+		_, errs := VerifyTransactions([]string{signJWS(t, "ES256", []*testCA{leaf, intermediate, root}, []byte("[]"))}, roots)
+		if errs[0] == nil {
+			t.Errorf("VerifyTransactions() error = nil, want unmarshaling error")
+		}
+	})
+}